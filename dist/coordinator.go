@@ -0,0 +1,175 @@
+package dist
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"os/exec"
+	"time"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// acceptTimeout bounds the wait for spawned workers to connect
+const acceptTimeout = 30 * time.Second
+
+// Result is the outcome of a distributed run
+type Result struct {
+	End       float64         // time the last download completed
+	Completed map[int]float64 // completion time of every node, negative if it did not complete
+	Uploaded  map[int]float64 // bytes uploaded by every node
+	Windows   int             // windows the workers were advanced by
+}
+
+// Run simulates sc over the workers connected by conns, the downloads of the
+// swarm are split between them by host. A scenario without a seed gets a time
+// based one, the same for every worker.
+func Run(sc sim.Scenario, conns []net.Conn) (Result, error) {
+	workers := make([]*conn, len(conns))
+	for i, c := range conns {
+		workers[i] = newConn(c)
+		defer c.Close()
+	}
+	res := Result{Completed: make(map[int]float64), Uploaded: make(map[int]float64)}
+	if len(workers) == 0 {
+		return res, fmt.Errorf("no workers")
+	}
+
+	if sc.Seed == 0 {
+		sc.Seed = time.Now().UnixNano()
+	}
+	lookahead := math.Inf(1)
+	for i, w := range workers {
+		if err := w.send(message{Kind: kindStart, Scenario: &sc, Index: i, Count: len(workers)}); err != nil {
+			return res, err
+		}
+	}
+	for i, w := range workers {
+		msg, err := w.expect(kindReady)
+		if err != nil {
+			return res, fmt.Errorf("worker %v: %v", i, err)
+		}
+		lookahead = math.Min(lookahead, msg.Lookahead)
+	}
+	// a transfer lasts at least the lookahead, rounding must not make it shorter
+	lookahead *= 1 - 1e-9
+
+	next := make([]float64, len(workers))
+	idle := make([]bool, len(workers))
+	reported := make([][]sim.Arrival, len(workers)) // arrivals started by every worker in the last window
+	for {
+		start := math.Inf(1)
+		for i := range workers {
+			if !idle[i] {
+				start = math.Min(start, next[i])
+			}
+		}
+		for _, arrivals := range reported {
+			for _, a := range arrivals {
+				start = math.Min(start, a.T)
+			}
+		}
+		if math.IsInf(start, 1) {
+			break
+		}
+
+		end := start + lookahead
+		for i, w := range workers {
+			// every other worker needs the chunks and the upload bandwidth of the transfers
+			var remote []sim.Arrival
+			for j, arrivals := range reported {
+				if j != i {
+					remote = append(remote, arrivals...)
+				}
+			}
+			if err := w.send(message{Kind: kindWindow, End: end, Arrivals: remote}); err != nil {
+				return res, err
+			}
+		}
+		for i, w := range workers {
+			msg, err := w.expect(kindReport)
+			if err != nil {
+				return res, fmt.Errorf("worker %v: %v", i, err)
+			}
+			for _, a := range msg.Arrivals {
+				if a.T < end {
+					return res, fmt.Errorf("worker %v: arrival at %v within the window ending at %v", i, a.T, end)
+				}
+			}
+			reported[i] = msg.Arrivals
+			next[i], idle[i] = msg.Next, msg.Idle
+		}
+		res.Windows++
+	}
+
+	for _, w := range workers {
+		if err := w.send(message{Kind: kindFinish}); err != nil {
+			return res, err
+		}
+	}
+	for i, w := range workers {
+		msg, err := w.expect(kindResult)
+		if err != nil {
+			return res, fmt.Errorf("worker %v: %v", i, err)
+		}
+		for _, r := range msg.Nodes {
+			if r.Owned {
+				res.Completed[r.ID] = r.Completed
+				res.End = math.Max(res.End, r.Completed)
+			}
+			res.Uploaded[r.ID] += r.UploadedBytes
+		}
+	}
+	return res, nil
+}
+
+// Accept waits for n workers to connect to l
+func Accept(l net.Listener, n int) ([]net.Conn, error) {
+	var conns []net.Conn
+	for len(conns) < n {
+		c, err := l.Accept()
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
+// RunLocal simulates sc over workers processes started with command and
+// args, followed by the address the workers must connect to
+func RunLocal(sc sim.Scenario, workers int, command string, args ...string) (Result, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return Result{}, err
+	}
+	defer l.Close()
+
+	var cmds []*exec.Cmd
+	defer func() {
+		for _, cmd := range cmds {
+			cmd.Wait()
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		cmd := exec.Command(command, append(args, l.Addr().String())...)
+		if err := cmd.Start(); err != nil {
+			return Result{}, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	// a worker that failed to start must not block the run forever
+	l.(*net.TCPListener).SetDeadline(time.Now().Add(acceptTimeout))
+	conns, err := Accept(l, workers)
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.Process.Kill()
+		}
+		return Result{}, err
+	}
+	return Run(sc, conns)
+}
@@ -0,0 +1,170 @@
+package dist
+
+import (
+	"net"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+	_ "github.com/minwhoo/dyrest-sim/strategy"
+)
+
+func testScenario() sim.Scenario {
+	sc := sim.DefaultScenario()
+	sc.NumNodes = 30
+	sc.NumSeeders = 2
+	sc.Seed = 11
+	sc.Speed = 0
+	return sc
+}
+
+// runWorkers runs sc over n workers served by goroutines
+func runWorkers(t *testing.T, sc sim.Scenario, n int) (Result, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := 0; i < n; i++ {
+		go Connect(l.Addr().String())
+	}
+	conns, err := Accept(l, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Run(sc, conns)
+}
+
+func TestSingleWorker(t *testing.T) {
+	sc := testScenario()
+	res, err := runWorkers(t, sc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a single worker runs the events of a whole run in the same order
+	sm := sim.NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	if res.End != sm.Supervisor().Now() {
+		t.Errorf("Expected the run to end at %v, got %v", sm.Supervisor().Now(), res.End)
+	}
+	for _, n := range sm.Supervisor().Nodes() {
+		if res.Uploaded[n.ID()] != n.UploadedBytes() {
+			t.Errorf("Expected node %v to upload %v bytes, got %v", n.ID(), n.UploadedBytes(), res.Uploaded[n.ID()])
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	for _, strategy := range []string{"dyrest", "fast", "adaptive"} {
+		sc := testScenario()
+		sc.Strategy = strategy
+		sc.CheckInvariants = true
+		res, err := runWorkers(t, sc, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Completed) != sc.NumNodes {
+			t.Fatalf("%s: Expected results for %v nodes, got %v", strategy, sc.NumNodes, len(res.Completed))
+		}
+		uploaded := 0.0
+		for id, at := range res.Completed {
+			if at < 0 {
+				t.Errorf("%s: Expected node %v to complete", strategy, id)
+			}
+			uploaded += res.Uploaded[id]
+		}
+		if res.End <= 0 || res.Windows == 0 || uploaded == 0 {
+			t.Errorf("%s: Expected a run with transfers, got %+v", strategy, res)
+		}
+	}
+}
+
+// TestWorkersMatchSingleProcess gives every host far more upload than
+// download capacity, so the upload reservations other workers learn of late
+// never change a choice and the workers must repeat the single process run
+func TestWorkersMatchSingleProcess(t *testing.T) {
+	sc := testScenario()
+	sc.DownloadRatio = 0.03
+	sc.Seed = 5
+	sc.CheckInvariants = true
+	sm := sim.NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	if err := sm.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{2, 3} {
+		res, err := runWorkers(t, sc, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range sm.Supervisor().Nodes() {
+			if at, ok := res.Completed[n.ID()]; !ok || at != n.CompletedAt() {
+				t.Errorf("%v workers: Expected node %v to complete at %v, got %v", workers, n.ID(), n.CompletedAt(), at)
+			}
+			if res.Uploaded[n.ID()] != n.UploadedBytes() {
+				t.Errorf("%v workers: Expected node %v to upload %v bytes, got %v", workers, n.ID(), n.UploadedBytes(), res.Uploaded[n.ID()])
+			}
+		}
+	}
+}
+
+func TestTimeSeed(t *testing.T) {
+	sc := testScenario()
+	sc.Seed = 0
+	sc.CheckInvariants = true
+	res, err := runWorkers(t, sc, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, at := range res.Completed {
+		if at < 0 {
+			t.Errorf("Expected node %v to complete", id)
+		}
+	}
+
+	// a worker refuses to pick a seed of its own
+	if err := sim.NewManager(nil).InitializePart(sc, 0, 2); err == nil {
+		t.Error("Expected a partition without a seed to be refused")
+	}
+}
+
+func TestUnsupportedScenario(t *testing.T) {
+	sc := testScenario()
+	sc.EndgameThreshold = 5
+	if _, err := runWorkers(t, sc, 2); err == nil {
+		t.Error("Expected endgame mode to be refused by the workers")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	arrivals := []sim.Arrival{{Node: 3, T: 1.5}}
+	go newConn(a).send(message{Kind: kindWindow, End: 2, Arrivals: arrivals})
+	msg, err := newConn(b).expect(kindWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.End != 2 || len(msg.Arrivals) != 1 || msg.Arrivals[0] != arrivals[0] {
+		t.Errorf("Expected the window to survive the round trip, got %+v", msg)
+	}
+
+	go newConn(a).send(message{Kind: kindError, Error: "boom"})
+	if _, err := newConn(b).receive(); err == nil || err.Error() != "boom" {
+		t.Errorf("Expected the error of the peer, got %v", err)
+	}
+}
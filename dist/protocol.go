@@ -0,0 +1,108 @@
+// Package dist runs a simulation across several worker processes. Every
+// worker simulates the downloads of a share of the hosts and keeps a copy of
+// the chunks and upload reservations of the whole swarm. A coordinator
+// advances the workers in windows of simulated time no longer than the
+// shortest transfer, so the chunks arriving within a window were requested
+// before it started and every worker learns of them in time. The upload
+// bandwidth a transfer reserves is only seen by the other workers from the
+// next window, a run matches the single process one as long as no uploader
+// is short of capacity.
+package dist
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// maxFrame bounds the size of a message, a corrupt length does not allocate more
+const maxFrame = 1 << 30
+
+// Kinds of messages. The coordinator sends start, window and finish, a worker
+// answers them with ready, report and result, or error.
+const (
+	kindStart  = "start"
+	kindReady  = "ready"
+	kindWindow = "window"
+	kindReport = "report"
+	kindFinish = "finish"
+	kindResult = "result"
+	kindError  = "error"
+)
+
+// message is a frame of the protocol: a big endian length followed by as many bytes of JSON
+type message struct {
+	Kind      string
+	Scenario  *sim.Scenario `json:",omitempty"`
+	Index     int
+	Count     int
+	Lookahead float64
+	End       float64
+	Arrivals  []sim.Arrival    `json:",omitempty"`
+	Next      float64          // time of the next event of the worker, meaningless when Idle
+	Idle      bool             // the worker has no event left
+	Nodes     []sim.NodeResult `json:",omitempty"`
+	Error     string           `json:",omitempty"`
+}
+
+// conn is a connection between the coordinator and a worker
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{c, bufio.NewReader(c), bufio.NewWriter(c)}
+}
+
+func (c *conn) send(msg message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(c.w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(data); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+// receive reads the next message, an error message of the peer is returned as error
+func (c *conn) receive() (message, error) {
+	var msg message
+	var size uint32
+	if err := binary.Read(c.r, binary.BigEndian, &size); err != nil {
+		return msg, err
+	}
+	if size > maxFrame {
+		return msg, errors.New("frame too large")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, err
+	}
+	if msg.Kind == kindError {
+		return msg, errors.New(msg.Error)
+	}
+	return msg, nil
+}
+
+// expect receives a message of kind
+func (c *conn) expect(kind string) (message, error) {
+	msg, err := c.receive()
+	if err == nil && msg.Kind != kind {
+		err = errors.New("unexpected " + msg.Kind + " message, expected " + kind)
+	}
+	return msg, err
+}
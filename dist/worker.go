@@ -0,0 +1,76 @@
+package dist
+
+import (
+	"fmt"
+	"math"
+	"net"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// Serve runs a worker over c until the coordinator finishes the run
+func Serve(c net.Conn) error {
+	defer c.Close()
+	wc := newConn(c)
+	err := serve(wc)
+	if err != nil {
+		// the coordinator may be waiting for an answer
+		wc.send(message{Kind: kindError, Error: err.Error()})
+	}
+	return err
+}
+
+// Connect runs a worker for the coordinator listening on addr
+func Connect(addr string) error {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(c)
+}
+
+func serve(wc *conn) error {
+	msg, err := wc.expect(kindStart)
+	if err != nil {
+		return err
+	}
+	if msg.Scenario == nil {
+		return fmt.Errorf("start message without scenario")
+	}
+	sm := sim.NewManager(nil)
+	if err := sm.InitializePart(*msg.Scenario, msg.Index, msg.Count); err != nil {
+		return err
+	}
+	// nothing ran yet, the first window starts with the first decisions
+	if err := wc.send(message{Kind: kindReady, Lookahead: sm.Lookahead()}); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := wc.receive()
+		if err != nil {
+			return err
+		}
+		switch msg.Kind {
+		case kindWindow:
+			if err := sm.Deliver(msg.Arrivals); err != nil {
+				return err
+			}
+			arrivals, next, err := sm.RunUntil(msg.End)
+			if err != nil {
+				return err
+			}
+			report := message{Kind: kindReport, Arrivals: arrivals, Next: next, Idle: math.IsInf(next, 1)}
+			if report.Idle {
+				report.Next = 0
+			}
+			if err := wc.send(report); err != nil {
+				return err
+			}
+		case kindFinish:
+			return wc.send(message{Kind: kindResult, Nodes: sm.PartResults()})
+		default:
+			return fmt.Errorf("unexpected %s message", msg.Kind)
+		}
+	}
+}
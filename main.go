@@ -1,114 +1,145 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
 	"log"
-	"math"
-	"sync"
+	"net"
+	"os"
+
+	"github.com/minwhoo/dyrest-sim/dist"
+	"github.com/minwhoo/dyrest-sim/model"
+	"github.com/minwhoo/dyrest-sim/sim"
+	_ "github.com/minwhoo/dyrest-sim/strategy"
+	"github.com/minwhoo/dyrest-sim/web"
 )
 
-var nodeIdx = 0
-
-type simulationManager struct {
-	running     bool
-	initialized bool
-	supervisor  supervisor
-	waitgroup   sync.WaitGroup
-	segfileInfo segfileInfo
-}
-
-func newSimulationManager() *simulationManager {
-	var wg sync.WaitGroup
-
-	sv := supervisor{
-		poolLock:    sync.RWMutex{},
-		pool:        make(map[*node]struct{}),
-		bwRatioLock: sync.RWMutex{},
-		bwRatio:     make(map[*node]float64),
-		lg:          logger{make(chan []byte)},
+func main() {
+	addr := flag.String("web", "", "serve the web interface on this address instead of running a scenario, e.g. :8080")
+	scenarioFile := flag.String("scenario", "", "JSON file of the scenario to run, fields left out keep their default value")
+	restoreFile := flag.String("restore", "", "checkpoint file to resume the simulation from instead of starting a new one")
+	strategy := flag.String("strategy", "", "strategy to use instead of the scenario's, e.g. to fork a restored checkpoint")
+	checkpointFile := flag.String("checkpoint", "", "file to write a checkpoint of the simulation to")
+	checkpointAt := flag.Float64("checkpoint-at", 0, "simulated time at which the checkpoint is taken")
+	analytic := flag.Bool("model", false, "report the rounds the analytic model needs to converge instead of running the simulation")
+	workers := flag.Int("workers", 0, "split the run over this many worker processes")
+	listen := flag.String("listen", "", "with -workers, wait for the workers to connect on this address instead of starting them")
+	workerOf := flag.String("worker", "", "run as a worker of the coordinator at this address")
+	check := flag.Bool("check", false, "check the invariants of the simulation after every event and stop at the first violation")
+	flag.Parse()
+
+	if *workerOf != "" {
+		if err := dist.Connect(*workerOf); err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		return
 	}
 
-	sm := simulationManager{
-		running:     false,
-		initialized: false,
-		supervisor:  sv,
-		waitgroup:   wg,
-		segfileInfo: newSegfileInfo(12*MB, 10, 512*KB),
+	if *addr != "" {
+		events := make(chan []byte)
+		sm := sim.NewManager(events)
+		sm.SetProgressLog(os.Stdout)
+		log.Fatalln(web.NewServer(sm, events).ListenAndServe(*addr))
 	}
 
-	return &sm
-}
-
-func (sm *simulationManager) initializeNodes() {
-	nodeIdx = 0
-	if sm.initialized {
-		log.Println("SIM: ERROR Nodes already initialized!")
-		return
-	}
-	var n *node
-	for i := 0; i < 5; i++ {
-		var ratio float64
-		if ratio = 0.5; i == 0 {
-			ratio = 1
+	sc := sim.DefaultScenario()
+	if *scenarioFile != "" {
+		data, err := ioutil.ReadFile(*scenarioFile)
+		if err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		if err := json.Unmarshal(data, &sc); err != nil {
+			log.Fatalln("SIM: ERROR", err)
 		}
-		n = newNode(&sm.segfileInfo, 10*MB, 1-1/math.E, ratio)
-		sm.supervisor.addNode(n)
 	}
-	sm.initialized = true
-	log.Println("SIM: Nodes initialized...")
-}
 
-func (sm *simulationManager) start() {
-	if sm.running {
-		log.Println("SIM: ERROR Simulation already running!")
-		return
+	if *strategy != "" {
+		sc.Strategy = *strategy
+	}
+	if *check {
+		sc.CheckInvariants = true
 	}
-	if !sm.initialized {
-		log.Println("SIM: ERROR Simulation not initialized!")
+	if *analytic {
+		m, err := model.New(sc)
+		if err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		log.Println("SIM: Model", m.Run())
 		return
 	}
 
-	sm.running = true
-	log.Println("SIM: Starting simulation...")
-
-	sm.supervisor.poolLock.RLock()
-	for n := range sm.supervisor.pool {
-		n.start(&sm.supervisor, &sm.waitgroup)
+	if *workers > 0 {
+		res, err := runDistributed(sc, *workers, *listen)
+		if err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		log.Println("SIM: Distributed run over", *workers, "workers done at", res.End, "after", res.Windows, "windows")
+		return
 	}
-	sm.supervisor.poolLock.RUnlock()
-
-	sm.waitgroup.Wait() // block
-	log.Println("SIM: Simulation done!")
-	sm.running = false
-}
 
-func (sm *simulationManager) reset() {
-	if sm.running {
-		log.Println("SIM: ERROR Simulation not finished yet!")
-		return
+	sm := sim.NewManager(nil)
+	sm.SetProgressLog(os.Stdout)
+	if *restoreFile != "" {
+		cp, err := sim.LoadCheckpoint(*restoreFile)
+		if err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		if *strategy != "" {
+			cp.Scenario.Strategy = *strategy
+		}
+		if *check {
+			cp.Scenario.CheckInvariants = true
+		}
+		if err := sm.Restore(cp); err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+	} else {
+		if err := sm.Initialize(sc); err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
 	}
-	if !sm.initialized {
-		log.Println("SIM: ERROR Nothing to reset!")
-		return
+	if *checkpointFile != "" {
+		sm.PauseAt(*checkpointAt)
 	}
-
-	pool := make(map[*node]struct{})
-
-	// copy list of nodes to delete
-	for n := range sm.supervisor.pool {
-		pool[n] = struct{}{}
+	if err := sm.Start(); err != nil {
+		log.Fatalln("SIM: ERROR", err)
 	}
-
-	for n := range pool {
-		sm.supervisor.removeNode(n)
+	if *checkpointFile != "" {
+		cp, err := sm.Checkpoint()
+		if err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		if err := cp.Save(*checkpointFile); err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+		log.Println("SIM: Checkpoint written to", *checkpointFile)
+		if err := sm.Resume(); err != nil {
+			log.Fatalln("SIM: ERROR", err)
+		}
+	}
+	sm.Wait()
+	if sm.Err() != nil {
+		// the error was logged when the run stopped
+		os.Exit(1)
 	}
-
-	sm.initialized = false
-	log.Println("SIM: Supervisor reset!")
 }
 
-func main() {
-	sm := newSimulationManager()
-	sm.initializeNodes()
-	sm.start()
-	//startWebInterface(sm)
+// runDistributed runs sc over workers started as processes of this binary, or
+// over workers started elsewhere connecting to listen
+func runDistributed(sc sim.Scenario, workers int, listen string) (dist.Result, error) {
+	if listen == "" {
+		return dist.RunLocal(sc, workers, os.Args[0], "-worker")
+	}
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		return dist.Result{}, err
+	}
+	defer l.Close()
+	log.Println("SIM: Waiting for", workers, "workers on", l.Addr())
+	conns, err := dist.Accept(l, workers)
+	if err != nil {
+		return dist.Result{}, err
+	}
+	return dist.Run(sc, conns)
 }
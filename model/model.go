@@ -0,0 +1,160 @@
+// Package model is a round based analytic model of a swarm. It starts from
+// the swarm the simulator would build for a scenario and lets every node take
+// chunks from its peers in synchronous rounds, ignoring bandwidth, to tell
+// how many rounds the swarm needs to converge or whether it never does.
+package model
+
+import (
+	"fmt"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// Result is the outcome of Run
+type Result struct {
+	Rounds    int         // rounds until every node completed, or until the swarm stopped changing
+	Converged bool        // every node completed its file
+	Completed map[int]int // round by which each node completed, by node id, -1 if it never did
+	Transfers int         // chunks transferred over all rounds
+}
+
+// Model is the swarm of a scenario reduced to the chunks each node holds
+type Model struct {
+	nodes       []*node
+	maxInFlight int
+	maxPerPeer  int
+}
+
+type node struct {
+	id int
+	sf *segfile.Segfile
+}
+
+// New builds the swarm of sc, nodes hold the chunks the simulator would give them for the same seed
+func New(sc sim.Scenario) (*Model, error) {
+	sm := sim.NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		return nil, err
+	}
+	m := Model{maxInFlight: sc.MaxInFlight, maxPerPeer: sc.MaxPerPeer}
+	for _, n := range sm.Supervisor().Nodes() {
+		sf := new(segfile.Segfile)
+		if err := sf.Restore(n.Segfile().Info, n.Segfile().State()); err != nil {
+			return nil, err
+		}
+		m.nodes = append(m.nodes, &node{n.ID(), sf})
+	}
+	return &m, nil
+}
+
+// Run plays rounds until every node completed or a round transfers nothing.
+// In a round every incomplete node takes up to MaxPerPeer chunks from each
+// peer of its swarm and MaxInFlight in total, choosing among the chunks its
+// peers held when the round started.
+func (m *Model) Run() Result {
+	res := Result{Completed: make(map[int]int)}
+	for _, n := range m.nodes {
+		if n.sf.TotalRemaining() == 0 {
+			res.Completed[n.id] = 0
+		} else {
+			res.Completed[n.id] = -1
+		}
+	}
+	for {
+		taken := m.round()
+		if len(taken) == 0 {
+			break
+		}
+		res.Rounds++
+		res.Transfers += len(taken)
+		for _, t := range taken {
+			t.n.sf.SetChunk(t.chunk, segfile.Available)
+		}
+		for _, n := range m.nodes {
+			if res.Completed[n.id] < 0 && n.sf.TotalRemaining() == 0 {
+				res.Completed[n.id] = res.Rounds
+			}
+		}
+	}
+	res.Converged = true
+	for _, round := range res.Completed {
+		if round < 0 {
+			res.Converged = false
+		}
+	}
+	return res
+}
+
+type take struct {
+	n     *node
+	chunk segfile.ChunkID
+}
+
+// round returns the chunks taken in one round, they are in flight until the caller marks them available
+func (m *Model) round() []take {
+	var taken []take
+	for _, n := range m.nodes {
+		if n.sf.TotalRemaining() == 0 {
+			continue
+		}
+		inFlight := 0
+		for _, p := range m.nodes {
+			if p == n || p.sf.Info != n.sf.Info {
+				continue
+			}
+			for k := 0; k < m.maxPerPeer && inFlight < m.maxInFlight; k++ {
+				chunk, ok := pick(n.sf, p.sf)
+				if !ok {
+					break
+				}
+				n.sf.SetChunk(chunk, segfile.PartiallyAvailable)
+				taken = append(taken, take{n, chunk})
+				inFlight++
+			}
+		}
+	}
+	return taken
+}
+
+// pick returns a chunk n needs that p can give. Data chunks help every
+// redundancy level and come first, otherwise p gives a parity chunk of the
+// level n is closest to decoding with. A peer holding a whole segment
+// generates any parity chunk of it.
+func pick(n *segfile.Segfile, p *segfile.Segfile) (segfile.ChunkID, bool) {
+	for sIdx := 0; sIdx < n.NumSegments; sIdx++ {
+		if n.IsSegmentComplete(sIdx) || n.IsSegmentPlannedComplete(sIdx) {
+			continue
+		}
+		for cIdx, status := range n.Chunks(sIdx, 0) {
+			chunk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: cIdx}
+			if status == segfile.NotAvailable && p.Status(chunk) == segfile.Available {
+				return chunk, true
+			}
+		}
+		best, found := segfile.ChunkID{}, false
+		for rIdx := 1; rIdx <= n.NumLevels(); rIdx++ {
+			if found && n.LevelRemaining(sIdx, rIdx) >= n.LevelRemaining(best.SIdx, best.RIdx) {
+				continue
+			}
+			for cIdx, status := range n.Chunks(sIdx, rIdx) {
+				chunk := segfile.ChunkID{SIdx: sIdx, RIdx: rIdx, CIdx: cIdx}
+				if status == segfile.NotAvailable && (p.IsSegmentComplete(sIdx) || p.Status(chunk) == segfile.Available) {
+					best, found = chunk, true
+					break
+				}
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+	return segfile.ChunkID{}, false
+}
+
+func (res Result) String() string {
+	if !res.Converged {
+		return fmt.Sprintf("no convergence, stalled after %v rounds and %v transfers", res.Rounds, res.Transfers)
+	}
+	return fmt.Sprintf("converged in %v rounds and %v transfers", res.Rounds, res.Transfers)
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+	_ "github.com/minwhoo/dyrest-sim/strategy"
+)
+
+func testScenario() sim.Scenario {
+	sc := sim.DefaultScenario()
+	sc.NumNodes = 12
+	sc.Seed = 3
+	sc.Speed = 0
+	return sc
+}
+
+func runModel(t *testing.T, sc sim.Scenario) Result {
+	m, err := New(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.Run()
+}
+
+func TestRounds(t *testing.T) {
+	// a single empty leecher takes one data chunk per seeder and round
+	sc := testScenario()
+	sc.NumNodes, sc.NumSeeders, sc.Availability = 3, 2, 0
+	res := runModel(t, sc)
+	numChunks := int(math.Ceil(sc.FileSize / sc.ChunkSize))
+	if want := (numChunks + 1) / 2; !res.Converged || res.Rounds != want {
+		t.Errorf("Expected convergence in %v rounds, got %v", want, res)
+	}
+	if res.Transfers != numChunks {
+		t.Errorf("Expected %v transfers, got %v", numChunks, res.Transfers)
+	}
+
+	sc.MaxInFlight = 1
+	if res := runModel(t, sc); res.Rounds != numChunks {
+		t.Errorf("Expected one chunk per round with a single transfer in flight, got %v", res)
+	}
+}
+
+func TestNoConvergence(t *testing.T) {
+	sc := testScenario()
+	sc.NumSeeders, sc.Availability = 0, 0
+	res := runModel(t, sc)
+	if res.Converged || res.Rounds != 0 || res.Transfers != 0 {
+		t.Errorf("Expected an empty swarm to stall at once, got %v", res)
+	}
+	for id, round := range res.Completed {
+		if round >= 0 {
+			t.Errorf("Expected node %v not to complete, got round %v", id, round)
+		}
+	}
+}
+
+// TestAgainstSimulation runs the model and the simulator on the same swarms,
+// they must agree on which nodes complete and the simulator cannot do with
+// fewer transfers than the model
+func TestAgainstSimulation(t *testing.T) {
+	scenarios := map[string]func(sc *sim.Scenario){
+		"seeded": func(sc *sim.Scenario) {},
+		"sparse": func(sc *sim.Scenario) { sc.NumSeeders, sc.Availability = 0, 0.2 },
+		"dense":  func(sc *sim.Scenario) { sc.NumSeeders, sc.Availability = 0, 0.7 },
+		"files": func(sc *sim.Scenario) {
+			sc.Files = []sim.FileSpec{{FileSize: 12 * sim.MB, NumSeeders: 1, Interest: 1}, {FileSize: 8 * sim.MB, NumSeeders: 0, Interest: 0.5}}
+		},
+		"flow":    func(sc *sim.Scenario) { sc.Strategy = "flow" },
+		"perpeer": func(sc *sim.Scenario) { sc.MaxPerPeer = 3 },
+	}
+	for name, setup := range scenarios {
+		sc := testScenario()
+		setup(&sc)
+		res := runModel(t, sc)
+
+		sm := sim.NewManager(nil)
+		if err := sm.Initialize(sc); err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.Start(); err != nil {
+			t.Fatal(err)
+		}
+		sm.Wait()
+
+		converged, uploaded := true, 0.0
+		for _, n := range sm.Supervisor().Nodes() {
+			if n.Complete() != (res.Completed[n.ID()] >= 0) {
+				t.Errorf("%s: Node %v completes in the simulation: %v, in the model: %v", name, n.ID(), n.Complete(), res.Completed[n.ID()] >= 0)
+			}
+			converged = converged && n.Complete()
+			uploaded += n.UploadedBytes()
+		}
+		if converged != res.Converged {
+			t.Errorf("%s: Simulation converged: %v, model: %v", name, converged, res)
+		}
+		if transfers := int(math.Round(uploaded / sc.ChunkSize)); transfers < res.Transfers {
+			t.Errorf("%s: Expected the simulation to transfer at least %v chunks, got %v", name, res.Transfers, transfers)
+		}
+	}
+}
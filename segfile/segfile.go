@@ -0,0 +1,517 @@
+// Package segfile models a file split into segments of data chunks, each
+// segment extended by redundancy levels of parity chunks, and tracks which
+// chunks a node holds, is downloading or still needs.
+package segfile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+const (
+	_          = iota
+	KB float64 = 1 << (10 * iota)
+	MB
+	GB
+	TB
+)
+
+const (
+	originalChunk int = iota
+	generatedChunk
+	generatableChunk
+)
+
+// Status is the state of a chunk at a node
+type Status int
+
+const (
+	NotAvailable Status = iota
+	PartiallyAvailable
+	Available
+)
+
+// ChunkID is chunk CIdx of redundancy level RIdx of segment SIdx, level 0 holds the data chunks
+type ChunkID struct {
+	SIdx int
+	RIdx int
+	CIdx int
+}
+
+// Less orders chunk ids by segment, redundancy level and index
+func (c ChunkID) Less(o ChunkID) bool {
+	if c.SIdx != o.SIdx {
+		return c.SIdx < o.SIdx
+	}
+	if c.RIdx != o.RIdx {
+		return c.RIdx < o.RIdx
+	}
+	return c.CIdx < o.CIdx
+}
+
+type segment struct {
+	idx             int
+	chunks          [][]Status // redundancy level, chunk index
+	remaining       []int
+	transferring    int
+	plannedComplete bool
+	complete        bool
+}
+
+// Segfile is the copy of a file held by one node
+type Segfile struct {
+	*Info
+	segments          []segment
+	numTransferChunks int
+	lock              sync.RWMutex
+	onAvailable       func(chkId ChunkID, segmentComplete bool)
+}
+
+// Info describes the layout of a file, it is shared by every copy of the file
+type Info struct {
+	NumSegments   int
+	NumDataChunks int
+	segmentSize   int
+	ChunkSize     float64
+	FileSize      float64
+	redundancy    []RedundancyLevel // redundancy level r is redundancy[r-1]
+}
+
+// RedundancyLevel is a set of parity chunks generated per segment. Once all of
+// its chunks are held the level stands in for Substitutes data chunks, so a
+// segment missing m data chunks and k chunks of the level still needs
+// m + k - Substitutes chunks.
+type RedundancyLevel struct {
+	Chunks      int
+	Substitutes int
+}
+
+// DefaultRedundancy is the original Dyrest scheme, level r has 2r chunks substituting r data chunks
+func DefaultRedundancy() []RedundancyLevel {
+	return []RedundancyLevel{{2, 1}, {4, 2}, {6, 3}}
+}
+
+// ValidateRedundancy checks levels for segments of segmentSize data chunks
+func ValidateRedundancy(levels []RedundancyLevel, segmentSize int) error {
+	for i, level := range levels {
+		if level.Chunks < 1 {
+			return fmt.Errorf("redundancy level %d must have at least one chunk", i+1)
+		}
+		if level.Substitutes < 0 || level.Substitutes > level.Chunks {
+			return fmt.Errorf("redundancy level %d must substitute between 0 and %d chunks", i+1, level.Chunks)
+		}
+		if level.Substitutes > segmentSize {
+			return fmt.Errorf("redundancy level %d cannot substitute more than the segment size %d", i+1, segmentSize)
+		}
+	}
+	return nil
+}
+
+// NumLevels returns the number of redundancy levels, not counting the data level 0
+func (sfinfo *Info) NumLevels() int {
+	return len(sfinfo.redundancy)
+}
+
+// Redundancy returns a copy of the redundancy levels of the file
+func (sfinfo *Info) Redundancy() []RedundancyLevel {
+	return append([]RedundancyLevel(nil), sfinfo.redundancy...)
+}
+
+// LevelSize returns the number of chunks of a segment at redundancy level rIdx
+func (sfinfo *Info) LevelSize(sIdx int, rIdx int) int {
+	if rIdx == 0 {
+		return sfinfo.SegmentSize(sIdx)
+	}
+	return sfinfo.redundancy[rIdx-1].Chunks
+}
+
+// Substitutes returns the number of data chunks level rIdx replaces, capped by the segment size
+func (sfinfo *Info) Substitutes(sIdx int, rIdx int) int {
+	if rIdx == 0 {
+		return 0
+	}
+	subs := sfinfo.redundancy[rIdx-1].Substitutes
+	if size := sfinfo.SegmentSize(sIdx); subs > size {
+		return size
+	}
+	return subs
+}
+
+// SegmentSize returns the number of data chunks of segment sIdx, the last segment may be shorter
+func (sfinfo *Info) SegmentSize(sIdx int) int {
+	r := sfinfo.NumDataChunks % sfinfo.segmentSize
+	if r != 0 && sIdx == sfinfo.NumSegments-1 {
+		return r
+	}
+	return sfinfo.segmentSize
+}
+
+// DataChunk returns the id of data chunk idx of the whole file
+func (sfinfo *Info) DataChunk(idx int) ChunkID {
+	return ChunkID{idx / sfinfo.segmentSize, 0, idx % sfinfo.segmentSize}
+}
+
+// NewInfo splits a file into segments of segmentSize data chunks of chunkSize bytes
+func NewInfo(fileSize float64, segmentSize int, chunkSize float64, redundancy []RedundancyLevel) (*Info, error) {
+	if segmentSize < 1 {
+		return nil, errors.New("segment size must be positive")
+	}
+	if err := ValidateRedundancy(redundancy, segmentSize); err != nil {
+		return nil, err
+	}
+	numChunks := int(fileSize / chunkSize)
+	if numChunks < 1 {
+		return nil, errors.New("file must contain at least one chunk")
+	}
+	numSegments := int(math.Ceil(float64(numChunks) / float64(segmentSize)))
+	levels := append([]RedundancyLevel(nil), redundancy...)
+	return &Info{numSegments, numChunks, segmentSize, float64(chunkSize), fileSize, levels}, nil
+}
+
+// Init makes sf an empty copy of the file described by sfinfo
+func (sf *Segfile) Init(sfinfo *Info) {
+	sf.Info = sfinfo
+	sf.segments = make([]segment, sfinfo.NumSegments)
+	numLevels := sfinfo.NumLevels() + 1
+	for i := 0; i < sfinfo.NumSegments; i++ {
+		sf.segments[i] = segment{i, make([][]Status, numLevels), make([]int, numLevels), 0, false, false}
+		for r := 0; r < numLevels; r++ {
+			sf.segments[i].chunks[r] = make([]Status, sfinfo.LevelSize(i, r))
+			sf.segments[i].remaining[r] = sfinfo.LevelSize(i, r)
+		}
+	}
+}
+
+// OnAvailable sets a function called whenever a chunk becomes available, after the segfile is unlocked
+func (sf *Segfile) OnAvailable(f func(chkId ChunkID, segmentComplete bool)) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.onAvailable = f
+}
+
+// Chunks returns the chunks of level rIdx of segment sIdx, the slice must not be modified
+func (sf *Segfile) Chunks(sIdx int, rIdx int) []Status {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return sf.segments[sIdx].chunks[rIdx]
+}
+
+// Availability returns a copy of every chunk status, indexed by segment, redundancy level and chunk
+func (sf *Segfile) Availability() [][][]Status {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	avail := make([][][]Status, len(sf.segments))
+	for sIdx, seg := range sf.segments {
+		avail[sIdx] = make([][]Status, len(seg.chunks))
+		for rIdx, chunks := range seg.chunks {
+			avail[sIdx][rIdx] = append([]Status(nil), chunks...)
+		}
+	}
+	return avail
+}
+
+// IsSegmentPlannedComplete reports whether the chunks held and in flight complete segment sIdx
+func (sf *Segfile) IsSegmentPlannedComplete(sIdx int) bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return sf.segments[sIdx].plannedComplete
+}
+
+// IsSegmentComplete reports whether the chunks held complete segment sIdx
+func (sf *Segfile) IsSegmentComplete(sIdx int) bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return sf.segments[sIdx].complete
+}
+
+// Status returns the status of a single chunk
+func (sf *Segfile) Status(chkId ChunkID) Status {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return sf.segments[chkId.SIdx].chunks[chkId.RIdx][chkId.CIdx]
+}
+
+// SegmentChunks returns a copy of the data chunks of segment sIdx followed by the chunks of level rIdx
+func (sf *Segfile) SegmentChunks(sIdx int, rIdx int) []Status {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	chunks := append([]Status(nil), sf.segments[sIdx].chunks[0]...)
+	if rIdx > 0 {
+		chunks = append(chunks, sf.segments[sIdx].chunks[rIdx]...)
+	}
+	return chunks
+}
+
+func (sf *Segfile) getTransferChunks() int {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	return sf.numTransferChunks
+}
+
+func (sf *Segfile) showSegments() {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	for _, seg := range sf.segments {
+		fmt.Printf("%v ", seg.chunks)
+	}
+	fmt.Printf("\n")
+}
+
+// TransferInProgress reports whether any chunk is partially available
+func (sf *Segfile) TransferInProgress() bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+
+	for _, seg := range sf.segments {
+		if seg.transferring > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetChunk is only called by owner node
+func (sf *Segfile) SetChunk(chkId ChunkID, newStatus Status) {
+	sf.lock.Lock()
+	sf.updateChunk(chkId, newStatus)
+	segmentComplete := sf.segments[chkId.SIdx].complete
+	onAvailable := sf.onAvailable
+	sf.lock.Unlock()
+
+	// listeners are called without the segfile lock, they may read other segfiles
+	if newStatus == Available && onAvailable != nil {
+		onAvailable(chkId, segmentComplete)
+	}
+}
+
+// updateChunk must be called with the lock held
+func (sf *Segfile) updateChunk(chkId ChunkID, newStatus Status) {
+	prevStatus := sf.segments[chkId.SIdx].chunks[chkId.RIdx][chkId.CIdx]
+
+	// check transfer status
+	if newStatus == PartiallyAvailable {
+		sf.segments[chkId.SIdx].transferring++
+	} else if prevStatus == PartiallyAvailable {
+		sf.segments[chkId.SIdx].transferring--
+	}
+
+	// set chunk
+	sf.segments[chkId.SIdx].chunks[chkId.RIdx][chkId.CIdx] = newStatus
+
+	// check remaining chunks
+	if newStatus == PartiallyAvailable {
+		if sf.plannedRemaining(chkId.SIdx) <= 0 {
+			sf.segments[chkId.SIdx].plannedComplete = true
+		}
+	} else if newStatus == Available {
+		sf.segments[chkId.SIdx].remaining[chkId.RIdx]--
+		if sf.checkRemaining(chkId.SIdx) == 0 {
+			for i := 0; i < sf.SegmentSize(chkId.SIdx); i++ {
+				sf.segments[chkId.SIdx].chunks[0][i] = Available
+			}
+			sf.segments[chkId.SIdx].complete = true
+			// segments complete from the start were never planned
+			sf.segments[chkId.SIdx].plannedComplete = true
+		}
+	}
+}
+
+func (sf *Segfile) checkRemaining(sIdx int) int {
+	// must call by other function that locks the segfile
+	minRemaining := sf.segments[sIdx].remaining[0]
+	for r := 1; r < len(sf.segments[sIdx].chunks); r++ {
+		if rRemaining := sf.levelRemaining(sIdx, r); rRemaining < minRemaining {
+			minRemaining = rRemaining
+		}
+	}
+	return minRemaining
+}
+
+// plannedRemaining is checkRemaining once every transfer in flight has
+// arrived. A parity chunk only counts towards the level it belongs to, so the
+// number of transfers alone does not tell whether the segment is planned.
+func (sf *Segfile) plannedRemaining(sIdx int) int {
+	// must call by other function that locks the segfile
+	seg := &sf.segments[sIdx]
+	remaining := make([]int, len(seg.chunks))
+	for r, chunks := range seg.chunks {
+		remaining[r] = seg.remaining[r]
+		for _, status := range chunks {
+			if status == PartiallyAvailable {
+				remaining[r]--
+			}
+		}
+	}
+	minRemaining := remaining[0]
+	for r := 1; r < len(remaining); r++ {
+		if rRemaining := remaining[0] + remaining[r] - sf.Substitutes(sIdx, r); rRemaining < minRemaining {
+			minRemaining = rRemaining
+		}
+	}
+	return minRemaining
+}
+
+// levelRemaining returns the number of chunks still needed to decode segment sIdx using redundancy level rIdx
+func (sf *Segfile) levelRemaining(sIdx int, rIdx int) int {
+	// must call by other function that locks the segfile
+	if rIdx == 0 {
+		return sf.segments[sIdx].remaining[0]
+	}
+	remaining := sf.segments[sIdx].remaining[0] + sf.segments[sIdx].remaining[rIdx] - sf.Substitutes(sIdx, rIdx)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// LevelRemaining returns the number of chunks still needed to decode segment sIdx using redundancy level rIdx
+func (sf *Segfile) LevelRemaining(sIdx int, rIdx int) int {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	return sf.levelRemaining(sIdx, rIdx)
+}
+
+// BestLevel returns the redundancy level needing the fewest chunks to complete segment sIdx
+func (sf *Segfile) BestLevel(sIdx int) int {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	best := 0
+	for r := 1; r <= sf.NumLevels(); r++ {
+		if sf.levelRemaining(sIdx, r) < sf.levelRemaining(sIdx, best) {
+			best = r
+		}
+	}
+	return best
+}
+
+// TotalRemaining returns the number of chunks still needed to complete the file
+func (sf *Segfile) TotalRemaining() int {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	total := 0
+	for i := 0; i < sf.NumSegments; i++ {
+		if !sf.segments[i].complete {
+			total += sf.checkRemaining(i)
+		}
+	}
+	return total
+}
+
+// PlannedComplete reports whether every segment is complete or planned complete
+func (sf *Segfile) PlannedComplete() bool {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	for i := 0; i < sf.NumSegments; i++ {
+		if !sf.segments[i].plannedComplete {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns the first inconsistency between the chunks of sf and the
+// counters kept for each segment, nil if there is none. The data chunks of a
+// complete segment are all marked available whatever its counters say.
+func (sf *Segfile) Check() error {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	for sIdx, seg := range sf.segments {
+		partial := 0
+		for r, chunks := range seg.chunks {
+			notAvailable := 0
+			for _, status := range chunks {
+				if status == PartiallyAvailable {
+					partial++
+				}
+				if status != Available {
+					notAvailable++
+				}
+			}
+			if !seg.complete && seg.remaining[r] != notAvailable {
+				return fmt.Errorf("segment %v level %v: %v chunks remaining, %v not available", sIdx, r, seg.remaining[r], notAvailable)
+			}
+		}
+		if seg.transferring != partial {
+			return fmt.Errorf("segment %v: %v chunks transferring, %v partially available", sIdx, seg.transferring, partial)
+		}
+		if seg.complete {
+			if !seg.plannedComplete {
+				return fmt.Errorf("segment %v: complete but not planned complete", sIdx)
+			}
+			continue
+		}
+		if remaining := sf.checkRemaining(sIdx); remaining <= 0 {
+			return fmt.Errorf("segment %v: not complete with %v chunks remaining", sIdx, remaining)
+		}
+		if planned := sf.plannedRemaining(sIdx) <= 0; seg.plannedComplete != planned {
+			return fmt.Errorf("segment %v: planned complete is %v, %v chunks remaining once transfers arrive", sIdx, seg.plannedComplete, sf.plannedRemaining(sIdx))
+		}
+	}
+	return nil
+}
+
+// SegmentState is the saved state of one segment of a Segfile
+type SegmentState struct {
+	Chunks          [][]Status // redundancy level, chunk index
+	Remaining       []int
+	Transferring    int
+	PlannedComplete bool
+	Complete        bool
+}
+
+// State is the saved state of a Segfile, chunks in flight included
+type State struct {
+	Segments          []SegmentState
+	NumTransferChunks int
+}
+
+// State returns a copy of the state of every segment
+func (sf *Segfile) State() State {
+	sf.lock.RLock()
+	defer sf.lock.RUnlock()
+	st := State{make([]SegmentState, len(sf.segments)), sf.numTransferChunks}
+	for sIdx, seg := range sf.segments {
+		chunks := make([][]Status, len(seg.chunks))
+		for rIdx := range seg.chunks {
+			chunks[rIdx] = append([]Status(nil), seg.chunks[rIdx]...)
+		}
+		st.Segments[sIdx] = SegmentState{chunks, append([]int(nil), seg.remaining...), seg.transferring, seg.plannedComplete, seg.complete}
+	}
+	return st
+}
+
+// Restore makes sf a copy of the file described by sfinfo in state st, the
+// onAvailable function is not called for the chunks restored
+func (sf *Segfile) Restore(sfinfo *Info, st State) error {
+	if len(st.Segments) != sfinfo.NumSegments {
+		return fmt.Errorf("expected %d segments, got %d", sfinfo.NumSegments, len(st.Segments))
+	}
+	numLevels := sfinfo.NumLevels() + 1
+	segments := make([]segment, sfinfo.NumSegments)
+	for sIdx, seg := range st.Segments {
+		if len(seg.Chunks) != numLevels || len(seg.Remaining) != numLevels {
+			return fmt.Errorf("segment %d: expected %d redundancy levels", sIdx, numLevels-1)
+		}
+		chunks := make([][]Status, numLevels)
+		for rIdx := range seg.Chunks {
+			if len(seg.Chunks[rIdx]) != sfinfo.LevelSize(sIdx, rIdx) {
+				return fmt.Errorf("segment %d: expected %d chunks at level %d", sIdx, sfinfo.LevelSize(sIdx, rIdx), rIdx)
+			}
+			chunks[rIdx] = append([]Status(nil), seg.Chunks[rIdx]...)
+		}
+		segments[sIdx] = segment{sIdx, chunks, append([]int(nil), seg.Remaining...), seg.Transferring, seg.PlannedComplete, seg.Complete}
+	}
+
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	sf.Info = sfinfo
+	sf.segments = segments
+	sf.numTransferChunks = st.NumTransferChunks
+	return nil
+}
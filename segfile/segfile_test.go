@@ -0,0 +1,152 @@
+package segfile
+
+import "testing"
+
+func TestNewSegfileInfoRedundancy(t *testing.T) {
+	invalid := [][]RedundancyLevel{
+		{{0, 0}},
+		{{2, 3}},
+		{{2, -1}},
+		{{20, 12}},
+	}
+	for _, levels := range invalid {
+		if _, err := NewInfo(12*MB, 10, 512*KB, levels); err == nil {
+			t.Errorf("Expected error for redundancy %v", levels)
+		}
+	}
+
+	sfi, err := NewInfo(12*MB, 10, 512*KB, []RedundancyLevel{{3, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sfi.NumLevels() != 1 || sfi.LevelSize(0, 1) != 3 || sfi.LevelSize(0, 0) != 10 {
+		t.Error("Unexpected level sizes", sfi.LevelSize(0, 0), sfi.LevelSize(0, 1))
+	}
+}
+
+func TestCheckRemaining(t *testing.T) {
+	sfi, _ := NewInfo(12*MB, 10, 512*KB, []RedundancyLevel{{3, 2}})
+	var sf Segfile
+	sf.Init(sfi)
+
+	for c := 0; c < 7; c++ {
+		sf.SetChunk(ChunkID{0, 0, c}, Available)
+	}
+	if r := sf.checkRemaining(0); r != 3 {
+		t.Errorf("Expected 3 remaining chunks, got %v", r)
+	}
+
+	// holding all 3 parity chunks stands in for 2 data chunks
+	for c := 0; c < 2; c++ {
+		sf.SetChunk(ChunkID{0, 1, c}, Available)
+	}
+	if r := sf.checkRemaining(0); r != 2 {
+		t.Errorf("Expected 2 remaining chunks, got %v", r)
+	}
+	sf.SetChunk(ChunkID{0, 1, 2}, Available)
+	if r := sf.checkRemaining(0); r != 1 {
+		t.Errorf("Expected 1 remaining chunk, got %v", r)
+	}
+	sf.SetChunk(ChunkID{0, 0, 7}, Available)
+	if !sf.IsSegmentComplete(0) {
+		t.Error("Expected segment to be complete")
+	}
+}
+
+func TestPlannedComplete(t *testing.T) {
+	sfi, _ := NewInfo(12*MB, 10, 512*KB, DefaultRedundancy())
+	var sf Segfile
+	sf.Init(sfi)
+
+	for c := 0; c < 4; c++ {
+		sf.SetChunk(ChunkID{0, 0, c}, Available)
+	}
+	// 6 transfers in flight, but both parity chunks of level 1 only replace one data chunk
+	sf.SetChunk(ChunkID{0, 1, 0}, PartiallyAvailable)
+	sf.SetChunk(ChunkID{0, 1, 1}, PartiallyAvailable)
+	for c := 4; c < 8; c++ {
+		sf.SetChunk(ChunkID{0, 0, c}, PartiallyAvailable)
+	}
+	if sf.segments[0].plannedComplete {
+		t.Error("Expected segment not to be planned complete")
+	}
+	sf.SetChunk(ChunkID{0, 0, 8}, PartiallyAvailable)
+	if !sf.segments[0].plannedComplete {
+		t.Error("Expected segment to be planned complete")
+	}
+}
+
+func TestInitiallyCompleteSegment(t *testing.T) {
+	sfi, _ := NewInfo(12*MB, 10, 512*KB, DefaultRedundancy())
+	var sf Segfile
+	sf.Init(sfi)
+
+	// the last segment only has four data chunks
+	for cIdx := 0; cIdx < 4; cIdx++ {
+		sf.SetChunk(ChunkID{2, 0, cIdx}, Available)
+	}
+	if !sf.IsSegmentComplete(2) || !sf.IsSegmentPlannedComplete(2) {
+		t.Error("Expected a segment completed without transfers to count as planned")
+	}
+}
+
+func TestStateRestore(t *testing.T) {
+	sfi, _ := NewInfo(12*MB, 10, 512*KB, DefaultRedundancy())
+	var sf Segfile
+	sf.Init(sfi)
+	sf.SetChunk(ChunkID{0, 0, 3}, Available)
+	sf.SetChunk(ChunkID{1, 2, 0}, PartiallyAvailable)
+
+	var restored Segfile
+	if err := restored.Restore(sfi, sf.State()); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Status(ChunkID{0, 0, 3}) != Available || restored.Status(ChunkID{1, 2, 0}) != PartiallyAvailable {
+		t.Error("Expected the chunks to be restored")
+	}
+	if restored.TotalRemaining() != sf.TotalRemaining() || restored.TransferInProgress() != sf.TransferInProgress() {
+		t.Error("Expected the remaining chunks and transfers to be restored")
+	}
+
+	// the copy must not share the chunks of the original
+	sf.SetChunk(ChunkID{1, 2, 0}, Available)
+	if restored.Status(ChunkID{1, 2, 0}) != PartiallyAvailable {
+		t.Error("Expected the restored segfile to be independent of the original")
+	}
+
+	other, _ := NewInfo(6*MB, 10, 512*KB, DefaultRedundancy())
+	if err := restored.Restore(other, sf.State()); err == nil {
+		t.Error("Expected an error restoring the state of another file")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	sfi, _ := NewInfo(12*MB, 10, 512*KB, DefaultRedundancy())
+	var sf Segfile
+	sf.Init(sfi)
+	for c := 0; c < 10; c++ {
+		sf.SetChunk(ChunkID{0, 0, c}, PartiallyAvailable)
+	}
+	sf.SetChunk(ChunkID{0, 0, 0}, Available)
+	for cIdx := 0; cIdx < 4; cIdx++ {
+		sf.SetChunk(ChunkID{2, 0, cIdx}, Available)
+	}
+	if err := sf.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	sf.segments[1].remaining[0]--
+	if sf.Check() == nil {
+		t.Error("Expected a remaining count out of sync to be reported")
+	}
+	sf.segments[1].remaining[0]++
+	sf.segments[0].transferring++
+	if sf.Check() == nil {
+		t.Error("Expected a transferring count out of sync to be reported")
+	}
+	sf.segments[0].transferring--
+	sf.segments[0].plannedComplete = false
+	if sf.Check() == nil {
+		t.Error("Expected a segment planned complete but not marked to be reported")
+	}
+}
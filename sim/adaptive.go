@@ -0,0 +1,94 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// AdaptivePolicy controls how the adaptive strategy moves a node between
+// redundancy levels. The level is picked when a node starts on a segment and
+// kept for that segment unless no peer can serve it any more.
+type AdaptivePolicy struct {
+	InitialLevel     int
+	RaiseFailureRate float64 // raise the level when more decisions than this fail
+	LowerFailureRate float64 // lower the level when fewer decisions than this fail
+	MinPeers         int     // raise the level when fewer peers than this can help with a segment
+	LowThroughput    float64 // raise the level when throughput drops below this share of the download capacity
+	Smoothing        float64 // weight of the newest observation in the moving averages
+	Interval         float64 // simulated seconds over which the bytes received make one throughput observation
+}
+
+func defaultAdaptivePolicy() AdaptivePolicy {
+	return AdaptivePolicy{
+		InitialLevel:     1,
+		RaiseFailureRate: 0.3,
+		LowerFailureRate: 0.05,
+		MinPeers:         2,
+		LowThroughput:    0.2,
+		Smoothing:        0.2,
+		Interval:         1,
+	}
+}
+
+func (pol *AdaptivePolicy) validate(numLevels int) error {
+	if pol.InitialLevel < 0 || pol.InitialLevel > numLevels {
+		return fmt.Errorf("initial redundancy level must be between 0 and %d", numLevels)
+	}
+	if pol.LowerFailureRate > pol.RaiseFailureRate {
+		return errors.New("lower failure rate must not exceed raise failure rate")
+	}
+	if pol.Smoothing <= 0 || pol.Smoothing > 1 {
+		return errors.New("smoothing must be between 0 exclusive and 1")
+	}
+	if pol.Interval <= 0 {
+		return errors.New("throughput interval must be positive")
+	}
+	return nil
+}
+
+// AdaptiveState is what the adaptive strategy observed of a node, owned by the simulation loop
+type AdaptiveState struct {
+	Level       int
+	Levels      map[int]int // chosen redundancy level per segment
+	FailureRate float64
+	Throughput  float64
+	Received    float64 // bytes received since the current interval started
+	Since       float64 // simulated time the current interval started
+}
+
+// Init starts from the initial level of pol unless the state is already in use
+func (st *AdaptiveState) Init(pol AdaptivePolicy) {
+	if st.Levels == nil {
+		st.Level = pol.InitialLevel
+		st.Levels = make(map[int]int)
+		st.Throughput = 1
+	}
+}
+
+// ObserveDecision updates the moving average of failed decisions
+func (st *AdaptiveState) ObserveDecision(failed bool, smoothing float64) {
+	var x float64
+	if failed {
+		x = 1
+	}
+	st.FailureRate = (1-smoothing)*st.FailureRate + smoothing*x
+}
+
+// ObserveReceived counts bytes received at simulated time now. Once an
+// interval of pol is over, the share of maxBw the node received at over all
+// its transfers updates the moving average of the throughput.
+func (st *AdaptiveState) ObserveReceived(bytes float64, now float64, maxBw float64, pol AdaptivePolicy) {
+	st.Received += bytes
+	if elapsed := now - st.Since; elapsed >= pol.Interval {
+		st.Throughput = (1-pol.Smoothing)*st.Throughput + pol.Smoothing*math.Min(st.Received/elapsed/maxBw, 1)
+		st.Received, st.Since = 0, now
+	}
+}
+
+// LevelChosen reports that n now targets redundancy level for segment sIdx, peers of the swarm being able to help
+func (sv *Supervisor) LevelChosen(n *Node, sIdx int, level int, peers int) {
+	st := &n.adaptive
+	sv.Printf("%v : segment %v targets redundancy level %v (failure rate %.2f, peers %v, throughput %.2f)\n", n.id, sIdx, level, st.FailureRate, peers, st.Throughput)
+	sv.lg.logRedundancyLevelChosen(n.id, sIdx, level, st.FailureRate, peers, st.Throughput)
+}
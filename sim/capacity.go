@@ -0,0 +1,152 @@
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bandwidthProfile is the access link of a node in bytes per second
+type bandwidthProfile struct {
+	Down float64
+	Up   float64
+}
+
+// bandwidthProfiles are typical residential access links
+var bandwidthProfiles = map[string]bandwidthProfile{
+	"fiber":  {100 * MB, 100 * MB},
+	"cable":  {12 * MB, 1.5 * MB},
+	"dsl":    {2 * MB, 0.5 * MB},
+	"mobile": {4 * MB, 1 * MB},
+}
+
+// ProfileShare assigns a named profile to a share of the hosts
+type ProfileShare struct {
+	Profile string
+	Share   float64
+}
+
+// cdfPoint is a row of an empirical bandwidth distribution, a node gets the
+// capacities of the first row whose cumulative probability reaches its draw
+type cdfPoint struct {
+	down float64
+	up   float64
+	p    float64
+}
+
+// capacitySampler draws the capacity of every host, from the profiles, the
+// empirical distribution or the uniform MaxBandwidth of the scenario
+type capacitySampler struct {
+	profiles []ProfileShare
+	cdf      []cdfPoint
+	maxBw    float64
+	ratio    float64
+}
+
+func newCapacitySampler(sc *Scenario) (capacitySampler, error) {
+	cs := capacitySampler{profiles: sc.Profiles, maxBw: sc.MaxBandwidth, ratio: sc.DownloadRatio}
+	if sc.BandwidthCDF != "" {
+		cdf, err := loadBandwidthCDF(sc.BandwidthCDF)
+		if err != nil {
+			return cs, err
+		}
+		cs.cdf = cdf
+	}
+	return cs, nil
+}
+
+// sample returns the total bandwidth of a host and the share used for downloading
+func (cs *capacitySampler) sample(rng *rand.Rand) (float64, float64) {
+	var down, up float64
+	switch {
+	case len(cs.cdf) > 0:
+		u := rng.Float64()
+		i := sort.Search(len(cs.cdf), func(i int) bool { return cs.cdf[i].p >= u })
+		if i == len(cs.cdf) {
+			i--
+		}
+		down, up = cs.cdf[i].down, cs.cdf[i].up
+	case len(cs.profiles) > 0:
+		total := 0.0
+		for _, ps := range cs.profiles {
+			total += ps.Share
+		}
+		u := rng.Float64() * total
+		prof := bandwidthProfiles[cs.profiles[len(cs.profiles)-1].Profile]
+		for _, ps := range cs.profiles {
+			if u < ps.Share {
+				prof = bandwidthProfiles[ps.Profile]
+				break
+			}
+			u -= ps.Share
+		}
+		down, up = prof.Down, prof.Up
+	default:
+		return cs.maxBw, cs.ratio
+	}
+	return down + up, down / (down + up)
+}
+
+func validateProfiles(profiles []ProfileShare) error {
+	for _, ps := range profiles {
+		if _, ok := bandwidthProfiles[ps.Profile]; !ok {
+			return fmt.Errorf("unknown bandwidth profile %q", ps.Profile)
+		}
+		if ps.Share <= 0 {
+			return errors.New("profile shares must be positive")
+		}
+	}
+	return nil
+}
+
+// loadBandwidthCDF reads an empirical distribution of node capacities. Every
+// line holds the download and upload capacity in MB/s and the cumulative
+// probability, e.g. "12,1.5,0.4", lines starting with # are ignored. Rows must
+// be sorted by probability, the last one is taken as 1.
+func loadBandwidthCDF(path string) ([]cdfPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cdf []cdfPoint
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected down,up,probability", path, line)
+		}
+		var values [3]float64
+		for i, field := range fields {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+		}
+		pt := cdfPoint{values[0] * MB, values[1] * MB, values[2]}
+		if pt.down <= 0 || pt.up <= 0 {
+			return nil, fmt.Errorf("%s:%d: capacities must be positive", path, line)
+		}
+		if n := len(cdf); pt.p < 0 || pt.p > 1 || (n > 0 && pt.p < cdf[n-1].p) {
+			return nil, fmt.Errorf("%s:%d: probabilities must increase from 0 to 1", path, line)
+		}
+		cdf = append(cdf, pt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cdf) == 0 {
+		return nil, fmt.Errorf("%s: no bandwidth rows", path)
+	}
+	cdf[len(cdf)-1].p = 1
+	return cdf, nil
+}
@@ -0,0 +1,69 @@
+package sim
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+func TestLoadBandwidthCDF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dyrest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cdf.csv")
+	ioutil.WriteFile(path, []byte("# down,up,p\n2,0.5,0.25\n\n12,1.5,0.9\n"), 0644)
+	cdf, err := loadBandwidthCDF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cdf) != 2 || cdf[1].p != 1 || cdf[0].down != 2*MB {
+		t.Errorf("Unexpected distribution %v", cdf)
+	}
+
+	cs := capacitySampler{cdf: cdf}
+	rng := rand.New(rand.NewSource(1))
+	slow := 0
+	for i := 0; i < 1000; i++ {
+		maxBw, ratio := cs.sample(rng)
+		if maxBw == 2.5*MB && math.Abs(ratio-0.8) < 1e-9 {
+			slow++
+		}
+	}
+	if slow < 200 || slow > 300 {
+		t.Errorf("Expected about a quarter of slow nodes, got %v of 1000", slow)
+	}
+
+	ioutil.WriteFile(path, []byte("12,1.5,0.9\n2,0.5,0.25\n"), 0644)
+	if _, err := loadBandwidthCDF(path); err == nil {
+		t.Error("Expected an error for decreasing probabilities")
+	}
+}
+
+func TestFairContention(t *testing.T) {
+	sv := initializeTestSupervisor()
+	sv.contention = "fair"
+	segfileInfo, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	p := sv.NewNode(segfileInfo, 10*MB, 0.5, 1)
+	sv.AddNode(p)
+	a := sv.NewNode(segfileInfo, 10*MB, 0.5, 0)
+	sv.AddNode(a)
+	b := sv.NewNode(segfileInfo, 10*MB, 0.5, 0)
+	sv.AddNode(b)
+
+	bw := sv.Bandwidth(a, p)
+	if bw != 5*MB {
+		t.Fatalf("Expected the whole upload capacity, got %v", bw/MB)
+	}
+	a.PrepareTransfer(Action{p, segfile.ChunkID{SIdx: 0, RIdx: 0, CIdx: 0}, bw / 2})
+	if bw = sv.Bandwidth(b, p); bw != 2.5*MB {
+		t.Errorf("Expected half of the upload capacity for the second transfer, got %v", bw/MB)
+	}
+}
@@ -0,0 +1,541 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// Checkpoint is the whole state of a simulation between two events: the
+// segfile of every node, the transfers in flight with the bytes they still
+// have to deliver, the random source, the simulated clock and the share of
+// upload capacity left by cross traffic. Restoring it continues the run
+// exactly as it would have gone on. Changing Scenario.Strategy before
+// restoring forks the run with another strategy, the other settings must
+// still describe the same swarm. Metrics totals start over on restore.
+type Checkpoint struct {
+	Scenario Scenario
+	Seed     int64  // seed of the random source
+	Draws    uint64 // values drawn from the random source so far
+	NextNode int    // id of the next node created
+	Hosts    []HostCheckpoint
+	Nodes    []NodeCheckpoint
+	Holders  []HolderCheckpoint // holder index of every file
+
+	// the run, unset if it has not started yet
+	Started     bool
+	Clock       float64
+	Seq         int // sequence number of the next event
+	Downloading int
+	Transfers   []TransferCheckpoint // in flight, in the order they started
+	Events      []EventCheckpoint    // decisions, departures and trace points, transfers keep their own end
+	Idle        []int                // nodes waiting for the swarm to change
+}
+
+// HostCheckpoint is the access link of a host and the bandwidth reserved on it
+type HostCheckpoint struct {
+	ID            int // index of the host
+	MaxBw         float64
+	DownloadRatio float64
+	Download      float64 // bandwidth reserved by the downloads in flight
+	Downloads     int
+	Upload        float64
+	Uploads       int
+	Trace         []TracePointCheckpoint // capacities the host follows, if any
+}
+
+// TracePointCheckpoint sets the capacity of a host from simulated time T on
+type TracePointCheckpoint struct {
+	T    float64
+	Down float64
+	Up   float64
+}
+
+// NodeCheckpoint is a node, its chunks and what it has done so far
+type NodeCheckpoint struct {
+	ID             int
+	Host           int
+	File           int
+	BwRatio        float64 // share of upload capacity free of cross traffic
+	Segfile        segfile.State
+	Complete       bool
+	RedundantBytes float64
+	Adaptive       AdaptiveState
+	UploadedBytes  float64
+	SeedSince      float64
+	Departed       bool
+	SuperSeeding   bool
+	Revealed       map[int]segfile.ChunkID // chunk offered to each peer when super-seeding
+	Playback       PlaybackCheckpoint
+}
+
+// PlaybackCheckpoint is the playback of a node in streaming mode
+type PlaybackCheckpoint struct {
+	Offsets     []float64
+	CompletedAt []float64
+	Started     bool
+	StartTime   float64
+	Next        int
+	Stalls      int
+	StallTime   float64
+}
+
+// HolderCheckpoint is the holder index of a file, the order of its lists
+// decides which holder a search meets first
+type HolderCheckpoint struct {
+	Bounds   map[int]float64 // upper bound of the upload rate of every indexed node
+	Lists    [][]int
+	Sorted   []bool
+	Unsorted []int
+}
+
+// TransferCheckpoint is a transfer in flight
+type TransferCheckpoint struct {
+	Node      int // receiver
+	Peer      int
+	Chunk     segfile.ChunkID
+	Bw        float64 // bandwidth reserved
+	Start     float64
+	Remaining float64 // bytes left at simulated time Updated
+	Updated   float64
+	Rate      float64
+	Want      float64
+	DownCap   float64
+	UpCap     float64
+	Finish    float64 // simulated time the transfer ends at its current rate
+	FinishSeq int
+}
+
+// EventCheckpoint is a decision of Node, its departure or trace point Point of the host of Node due at T
+type EventCheckpoint struct {
+	T         float64
+	Seq       int
+	Trace     bool
+	Departure bool `json:",omitempty"`
+	Node      int
+	Point     int `json:",omitempty"`
+}
+
+// LoadCheckpoint reads a checkpoint saved with Checkpoint.Save
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &cp, nil
+}
+
+// Save writes cp to path as JSON
+func (cp *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Checkpoint returns the state of the simulation. A running simulation must
+// be paused, or about to pause with PauseAt, the checkpoint is taken once it
+// waits between two events.
+func (sm *Manager) Checkpoint() (*Checkpoint, error) {
+	sm.lock.Lock()
+	initialized, running, done, started := sm.initialized, sm.running, sm.done, sm.started
+	sm.lock.Unlock()
+	if !initialized {
+		return nil, errors.New("simulation not initialized")
+	}
+	if sm.supervisor.part != nil {
+		return nil, errors.New("a worker of a distributed run cannot be checkpointed")
+	}
+	if started && sm.scenario.Emulate {
+		// the bytes on the wire are not part of the state
+		return nil, errors.New("an emulated run cannot be checkpointed once started")
+	}
+	if running {
+		if !sm.controller.hold(done) {
+			return nil, errors.New("simulation must be paused to take a checkpoint")
+		}
+		defer sm.controller.release()
+	}
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	cp := sm.supervisor.checkpoint(sm.segfileInfos)
+	cp.Scenario = sm.scenario
+	cp.Started = sm.started
+	if !cp.Started {
+		cp.Clock, cp.Seq, cp.Downloading = 0, 0, 0
+		cp.Transfers, cp.Events, cp.Idle = nil, nil, nil
+	}
+	log.Println("SIM: Checkpoint taken at", cp.Clock)
+	return cp, nil
+}
+
+// checkpoint saves the swarms of the files sfis and the run, no event may run meanwhile
+func (sv *Supervisor) checkpoint(sfis []*segfile.Info) *Checkpoint {
+	sv.poolLock.RLock()
+	nodes := sv.sortedPool()
+	hosts := sv.checkpointHosts()
+	sv.poolLock.RUnlock()
+
+	cp := &Checkpoint{
+		Seed:        sv.src.seed,
+		Draws:       sv.src.draws,
+		NextNode:    sv.nodeIdx,
+		Clock:       sv.sim.clock,
+		Seq:         sv.sim.seq,
+		Downloading: sv.sim.downloading,
+		Hosts:       hosts,
+	}
+	files := make(map[*segfile.Info]int)
+	for f, sfi := range sfis {
+		files[sfi] = f
+	}
+
+	sv.bwRatioLock.RLock()
+	for _, n := range nodes {
+		nc := NodeCheckpoint{
+			ID:             n.id,
+			Host:           n.host,
+			File:           files[n.sf.Info],
+			BwRatio:        sv.bwRatio[n],
+			Segfile:        n.sf.State(),
+			Complete:       n.complete,
+			RedundantBytes: n.redundantBytes,
+			Adaptive:       n.adaptive,
+		}
+		n.seeder.lock.Lock()
+		nc.UploadedBytes, nc.SeedSince = n.seeder.uploadedBytes, n.seeder.seedSince
+		nc.Departed, nc.SuperSeeding = n.seeder.departed, n.seeder.superSeeding
+		nc.Revealed = make(map[int]segfile.ChunkID)
+		for p, chk := range n.seeder.revealed {
+			nc.Revealed[p.id] = chk
+		}
+		n.seeder.lock.Unlock()
+		st := &n.playback
+		st.lock.Lock()
+		nc.Playback = PlaybackCheckpoint{st.offsets, st.completedAt, st.started, st.startTime, st.next, st.stalls, st.stallTime}
+		st.lock.Unlock()
+		cp.Nodes = append(cp.Nodes, nc)
+	}
+	sv.bwRatioLock.RUnlock()
+
+	for _, sfi := range sfis {
+		cp.Holders = append(cp.Holders, sv.holderIndex(sfi).checkpoint())
+	}
+
+	for _, h := range sv.sim.inFlight {
+		cp.Transfers = append(cp.Transfers, TransferCheckpoint{
+			h.n.id, h.act.Peer.id, h.act.Chunk, h.act.Bw, h.startSim, h.remaining, h.updated,
+			h.rate, h.want, h.downCap, h.upCap, h.finish.t, h.finish.seq,
+		})
+	}
+	for _, e := range sv.sim.queue {
+		if e.cancelled || e.kind == eventFinish {
+			continue
+		}
+		cp.Events = append(cp.Events, EventCheckpoint{e.t, e.seq, e.kind == eventTrace, e.kind == eventDeparture, e.n.id, e.point})
+	}
+	for _, n := range sv.sim.idle {
+		cp.Idle = append(cp.Idle, n.id)
+	}
+	return cp
+}
+
+// checkpointHosts returns the links of every host by index, must be called with poolLock held
+func (sv *Supervisor) checkpointHosts() []HostCheckpoint {
+	var checkpoints []HostCheckpoint
+	var hosts []int
+	for h := range sv.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Ints(hosts)
+	for _, h := range hosts {
+		n := sv.hosts[h]
+		hc := HostCheckpoint{
+			ID:        h,
+			Download:  n.currentDownloadBw.get(),
+			Downloads: n.currentDownloadBw.getTransfers(),
+			Upload:    n.currentUploadBw.get(),
+			Uploads:   n.currentUploadBw.getTransfers(),
+		}
+		n.link.RLock()
+		hc.MaxBw, hc.DownloadRatio = n.link.maxBw, n.link.ratio
+		n.link.RUnlock()
+		for _, pt := range sv.traces[h] {
+			hc.Trace = append(hc.Trace, TracePointCheckpoint{pt.t, pt.down, pt.up})
+		}
+		checkpoints = append(checkpoints, hc)
+	}
+	return checkpoints
+}
+
+func (hi *HolderIndex) checkpoint() HolderCheckpoint {
+	hi.lock.RLock()
+	defer hi.lock.RUnlock()
+	hc := HolderCheckpoint{
+		Bounds:   make(map[int]float64),
+		Lists:    make([][]int, len(hi.lists)),
+		Sorted:   make([]bool, len(hi.lists)),
+		Unsorted: append([]int(nil), hi.unsorted...),
+	}
+	for n, bound := range hi.bounds {
+		hc.Bounds[n.id] = bound
+	}
+	for i, l := range hi.lists {
+		hc.Lists[i] = make([]int, len(l.nodes))
+		for j, n := range l.nodes {
+			hc.Lists[i][j] = n.id
+		}
+		hc.Sorted[i] = l.sorted
+	}
+	return hc
+}
+
+// Restore sets up the swarms and run saved in cp, Start continues the run
+func (sm *Manager) Restore(cp *Checkpoint) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if sm.initialized {
+		return errors.New("nodes already initialized")
+	}
+	sc := cp.Scenario
+	if err := sc.validate(); err != nil {
+		return err
+	}
+	files := sc.getFiles()
+	sfis := make([]*segfile.Info, len(files))
+	for f, spec := range files {
+		sfi, err := segfile.NewInfo(spec.FileSize, sc.SegmentSize, sc.ChunkSize, sc.Redundancy)
+		if err != nil {
+			return err
+		}
+		sfis[f] = sfi
+	}
+
+	sv := &sm.supervisor
+	sv.configure(&sc)
+	if err := sv.restore(cp, sfis); err != nil {
+		// leave the supervisor empty so the manager can be initialized again
+		for _, n := range sv.Nodes() {
+			sv.RemoveNode(n)
+		}
+		sv.mt.reset()
+		return err
+	}
+	sm.scenario = sc
+	sm.segfileInfos = sfis
+	sm.started = cp.Started
+	sm.initialized = true
+	log.Println("SIM: Checkpoint restored at", cp.Clock)
+	sv.lg.logSimulationState(stateInitialized)
+	return nil
+}
+
+// restore rebuilds the nodes, holder indexes and run of cp on a configured supervisor
+func (sv *Supervisor) restore(cp *Checkpoint, sfis []*segfile.Info) error {
+	sv.src = newCountingSource(cp.Seed, cp.Draws)
+	sv.rng = rand.New(sv.src)
+	sv.nodeIdx = cp.NextNode
+
+	// the nodes of a host share the link and bandwidth of a node standing for it
+	hosts := make(map[int]*Node)
+	for _, hc := range cp.Hosts {
+		hosts[hc.ID] = &Node{
+			host:              hc.ID,
+			link:              newHostLink(hc.MaxBw, hc.DownloadRatio),
+			currentDownloadBw: &bandwidth{sync.RWMutex{}, hc.Download, hc.Downloads},
+			currentUploadBw:   &bandwidth{sync.RWMutex{}, hc.Upload, hc.Uploads},
+		}
+		for _, pt := range hc.Trace {
+			sv.traces[hc.ID] = append(sv.traces[hc.ID], tracePoint{pt.T, pt.Down, pt.Up})
+		}
+	}
+	nodes := make(map[int]*Node)
+	for _, nc := range cp.Nodes {
+		if nc.File < 0 || nc.File >= len(sfis) {
+			return fmt.Errorf("node %d: unknown file %d", nc.ID, nc.File)
+		}
+		n := &Node{
+			id:             nc.ID,
+			host:           nc.Host,
+			file:           nc.File,
+			holders:        sv.holderIndex(sfis[nc.File]),
+			connectedNodes: make(map[*Node]int),
+			complete:       nc.Complete,
+			adaptive:       nc.Adaptive,
+			transfers:      make(map[segfile.ChunkID][]*transferHandle),
+			redundantBytes: nc.RedundantBytes,
+		}
+		if err := n.sf.Restore(sfis[nc.File], nc.Segfile); err != nil {
+			return fmt.Errorf("node %d: %v", nc.ID, err)
+		}
+		if h, ok := hosts[nc.Host]; ok {
+			n.shareHost(h)
+		} else {
+			return fmt.Errorf("node %d: unknown host %d", nc.ID, nc.Host)
+		}
+		n.seeder.init(false)
+		n.seeder.uploadedBytes, n.seeder.seedSince = nc.UploadedBytes, nc.SeedSince
+		n.seeder.departed, n.seeder.superSeeding = nc.Departed, nc.SuperSeeding
+		pb := nc.Playback
+		n.playback = playbackState{offsets: pb.Offsets, completedAt: pb.CompletedAt, started: pb.Started,
+			startTime: pb.StartTime, next: pb.Next, stalls: pb.Stalls, stallTime: pb.StallTime}
+		nodes[nc.ID] = n
+	}
+	node := func(id int) (*Node, error) {
+		if n, ok := nodes[id]; ok {
+			return n, nil
+		}
+		return nil, fmt.Errorf("unknown node %d", id)
+	}
+
+	for _, nc := range cp.Nodes {
+		n := nodes[nc.ID]
+		for id, chk := range nc.Revealed {
+			p, err := node(id)
+			if err != nil {
+				return err
+			}
+			n.seeder.revealed[p] = chk
+		}
+		sv.poolLock.Lock()
+		sv.pool[n] = struct{}{}
+		if _, ok := sv.hosts[n.host]; !ok {
+			sv.hosts[n.host] = n
+		}
+		sv.poolLock.Unlock()
+		sv.bwRatioLock.Lock()
+		sv.bwRatio[n] = nc.BwRatio
+		sv.bwRatioLock.Unlock()
+		sv.mt.nodeAdded(n.complete)
+		if nc.Departed {
+			sv.mt.nodeDeparted()
+		}
+		sv.lg.logNodeAdded(n)
+	}
+
+	if len(cp.Holders) != len(sfis) {
+		return fmt.Errorf("expected the holders of %d files, got %d", len(sfis), len(cp.Holders))
+	}
+	for f, hc := range cp.Holders {
+		if err := sv.holderIndex(sfis[f]).restore(hc, node); err != nil {
+			return fmt.Errorf("holders of file %d: %v", f, err)
+		}
+	}
+
+	if !cp.Started {
+		return nil
+	}
+	sv.sim = simulation{clock: cp.Clock, seq: cp.Seq, downloading: cp.Downloading, speed: sv.sim.speed}
+	for _, tc := range cp.Transfers {
+		n, err := node(tc.Node)
+		if err != nil {
+			return err
+		}
+		p, err := node(tc.Peer)
+		if err != nil {
+			return err
+		}
+		h := &transferHandle{
+			n:         n,
+			act:       Action{p, tc.Chunk, tc.Bw},
+			startSim:  tc.Start,
+			remaining: tc.Remaining,
+			updated:   tc.Updated,
+			rate:      tc.Rate,
+			want:      tc.Want,
+			downCap:   tc.DownCap,
+			upCap:     tc.UpCap,
+		}
+		h.finish = &event{t: tc.Finish, seq: tc.FinishSeq, run: func() { h.n.finishTransfer(sv, h) }, kind: eventFinish, n: n, chunk: tc.Chunk}
+		sv.push(h.finish)
+		n.transfers[tc.Chunk] = append(n.transfers[tc.Chunk], h)
+		n.connectedNodes[p]++
+		sv.addInFlight(h)
+		sv.mt.transferStarted()
+	}
+	for _, ec := range cp.Events {
+		n, err := node(ec.Node)
+		if err != nil {
+			return err
+		}
+		e := &event{t: ec.T, seq: ec.Seq, n: n}
+		if ec.Trace {
+			trace := sv.traces[n.host]
+			if ec.Point < 0 || ec.Point >= len(trace) {
+				return fmt.Errorf("host %d has no trace point %d", n.host, ec.Point)
+			}
+			e.run, e.background, e.kind, e.point = sv.applyTracePoint(n, trace[ec.Point]), true, eventTrace, ec.Point
+		} else if ec.Departure {
+			e.run, e.background, e.kind = func() { sv.seedingOver(n) }, true, eventDeparture
+		} else {
+			e.run, e.kind = func() { n.decide(sv) }, eventDecision
+		}
+		sv.push(e)
+	}
+	for _, id := range cp.Idle {
+		n, err := node(id)
+		if err != nil {
+			return err
+		}
+		sv.sim.idle = append(sv.sim.idle, n)
+	}
+	return nil
+}
+
+// restore replaces the index with hc, node looks up the nodes by id
+func (hi *HolderIndex) restore(hc HolderCheckpoint, node func(id int) (*Node, error)) error {
+	if len(hc.Lists) != len(hi.lists) || len(hc.Sorted) != len(hi.lists) {
+		return fmt.Errorf("expected %d lists, got %d", len(hi.lists), len(hc.Lists))
+	}
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	for id, bound := range hc.Bounds {
+		n, err := node(id)
+		if err != nil {
+			return err
+		}
+		if n.holders != hi {
+			return fmt.Errorf("node %d is in the swarm of another file", id)
+		}
+		hi.bounds[n] = bound
+		hi.held[n] = make([]bool, len(hi.lists))
+		n.sf.OnAvailable(func(chkId segfile.ChunkID, segmentComplete bool) {
+			hi.chunkAvailable(n, chkId, segmentComplete)
+		})
+	}
+	for i, ids := range hc.Lists {
+		l := &hi.lists[i]
+		l.nodes, l.sorted = nil, hc.Sorted[i]
+		for _, id := range ids {
+			n, err := node(id)
+			if err != nil {
+				return err
+			}
+			if _, ok := hi.held[n]; !ok {
+				return fmt.Errorf("node %d is listed but not indexed", id)
+			}
+			hi.held[n][i] = true
+			l.nodes = append(l.nodes, n)
+		}
+	}
+	for _, i := range hc.Unsorted {
+		if i < 0 || i >= len(hi.lists) {
+			return fmt.Errorf("unknown list %d", i)
+		}
+	}
+	hi.unsorted = append(hi.unsorted[:0], hc.Unsorted...)
+	return nil
+}
@@ -0,0 +1,158 @@
+package sim_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+// outcome is what a finished run did: its end time and the bytes every node uploaded
+type outcome struct {
+	end      float64
+	uploaded map[int]float64
+}
+
+func getOutcome(sm *Manager) outcome {
+	o := outcome{sm.Supervisor().Now(), make(map[int]float64)}
+	for _, n := range sm.Supervisor().Nodes() {
+		o.uploaded[n.ID()] = n.UploadedBytes()
+	}
+	return o
+}
+
+func compareOutcomes(t *testing.T, name string, want outcome, got outcome) {
+	if want.end != got.end {
+		t.Errorf("%s: Expected the run to end at %v, got %v", name, want.end, got.end)
+	}
+	for id, bytes := range want.uploaded {
+		if got.uploaded[id] != bytes {
+			t.Errorf("%s: Expected node %v to upload %v bytes, got %v", name, id, bytes, got.uploaded[id])
+		}
+	}
+}
+
+// restoreScenario restores cp in a new manager and runs it to its end
+func restoreScenario(t *testing.T, cp *Checkpoint) *Manager {
+	sm := NewManager(nil)
+	if err := sm.Restore(cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	return sm
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dyrest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"plain", "traces", "endgame", "seeding", "leave", "stream", "files", "sparse", "rounds"} {
+		sc := DefaultScenario()
+		sc.NumNodes = 30
+		sc.NumSeeders = 2
+		sc.Seed = 7
+		sc.Speed = 0
+		stressScenarios[name](&sc)
+		want := getOutcome(runScenario(t, sc))
+
+		sm := NewManager(nil)
+		if err := sm.Initialize(sc); err != nil {
+			t.Fatal(err)
+		}
+		before, err := sm.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sm.PauseAt(want.end / 2)
+		if err := sm.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := sm.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cp.Started || cp.Clock > want.end/2 || len(cp.Transfers) == 0 {
+			t.Fatalf("%s: Expected a checkpoint with transfers in flight before %v, got %v transfers at %v", name, want.end/2, len(cp.Transfers), cp.Clock)
+		}
+		path := filepath.Join(dir, name+".json")
+		if err := cp.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		sm.Resume()
+		sm.Wait()
+		compareOutcomes(t, name+"/checkpointed", want, getOutcome(sm))
+
+		loaded, err := LoadCheckpoint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := restoreScenario(t, loaded)
+		checkQuiescent(t, name+"/restored", restored)
+		compareOutcomes(t, name+"/restored", want, getOutcome(restored))
+
+		// a checkpoint of an initialized swarm restores before the run starts
+		compareOutcomes(t, name+"/initialized", want, getOutcome(restoreScenario(t, before)))
+
+		cp.Scenario.Strategy = "fast"
+		checkQuiescent(t, name+"/fork", restoreScenario(t, cp))
+	}
+}
+
+// TestCheckpointHosts checks a swarm whose host indexes differ from the ids of
+// their first nodes, the first file leaving some hosts out
+func TestCheckpointHosts(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 10
+	sc.Seed = 4
+	sc.Files = []FileSpec{{12 * MB, 1, 0.5}, {8 * MB, 1, 1}}
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := sm.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := make(map[int]bool)
+	for _, n := range sm.Supervisor().Nodes() {
+		hosts[n.Host()] = true
+	}
+	if len(cp.Hosts) != len(hosts) {
+		t.Errorf("Expected a checkpoint of %v hosts, got %v", len(hosts), len(cp.Hosts))
+	}
+	checkQuiescent(t, "hosts", restoreScenario(t, cp))
+}
+
+func TestCheckpointErrors(t *testing.T) {
+	sm := NewManager(nil)
+	if _, err := sm.Checkpoint(); err == nil {
+		t.Error("Expected an error taking a checkpoint without nodes")
+	}
+
+	sc := DefaultScenario()
+	sc.NumNodes = 10
+	sc.Seed = 1
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := sm.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Restore(cp); err == nil {
+		t.Error("Expected an error restoring into an initialized manager")
+	}
+
+	cp.Scenario.FileSize /= 2
+	if err := NewManager(nil).Restore(cp); err == nil {
+		t.Error("Expected an error restoring the checkpoint of another file")
+	}
+}
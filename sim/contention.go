@@ -0,0 +1,51 @@
+package sim
+
+import "math"
+
+// contentionModel returns the rate a new transfer from p to n gets, given the
+// download capacity n and the upload capacity p have not reserved yet. A
+// transfer keeps its rate until it finishes.
+type contentionModel func(sv *Supervisor, n *Node, p *Node, freeDown float64, freeUp float64) float64
+
+// contentionModels are the choices for Scenario.Contention:
+//
+//	greedy        the transfer takes all capacity left on both ends
+//	fair          the transfer takes at most an equal share of the capacity of
+//	              each end among its transfers, including the new one
+//	crosstraffic  like greedy, but each uploader only has the share bwRatio of
+//	              its free capacity available, the rest being used by traffic
+//	              outside the simulation; the share is drawn uniformly from
+//	              0.1-1 per node when it is added
+var contentionModels = map[string]contentionModel{
+	"greedy":       greedyContention,
+	"fair":         fairContention,
+	"crosstraffic": crossTrafficContention,
+}
+
+func greedyContention(sv *Supervisor, n *Node, p *Node, freeDown float64, freeUp float64) float64 {
+	return math.Min(freeDown, freeUp)
+}
+
+func fairContention(sv *Supervisor, n *Node, p *Node, freeDown float64, freeUp float64) float64 {
+	downShare := n.MaxDownloadBw() / float64(n.InFlight()+1)
+	upShare := p.MaxUploadBw() / float64(p.currentUploadBw.getTransfers()+1)
+	return math.Min(math.Min(freeDown, freeUp), math.Min(downShare, upShare))
+}
+
+func crossTrafficContention(sv *Supervisor, n *Node, p *Node, freeDown float64, freeUp float64) float64 {
+	sv.bwRatioLock.RLock()
+	defer sv.bwRatioLock.RUnlock()
+	return math.Min(freeDown, freeUp) * sv.bwRatio[p]
+}
+
+// rateBound returns the fastest rate any transfer from p can get under the
+// contention model while host capacities stay fixed
+func (sv *Supervisor) rateBound(p *Node) float64 {
+	bound := p.MaxUploadBw()
+	if _, ok := contentionModels[sv.contention]; !ok || sv.contention == "crosstraffic" {
+		sv.bwRatioLock.RLock()
+		bound *= sv.bwRatio[p]
+		sv.bwRatioLock.RUnlock()
+	}
+	return bound
+}
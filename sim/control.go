@@ -0,0 +1,140 @@
+package sim
+
+import (
+	"context"
+	"sync"
+)
+
+// controller gates simulation events so a running simulation can be paused,
+// resumed or advanced a fixed number of events at a time
+type controller struct {
+	lock    sync.Mutex
+	paused  bool
+	steps   int
+	pauseAt float64 // simulated time the run pauses at, negative if unset
+	parked  bool    // the run is waiting for its next event to be let through
+	changed chan struct{}
+	onPark  func(parked bool) // told when the run parks and when it goes on, may be nil
+}
+
+func newController() *controller {
+	return &controller{pauseAt: -1, changed: make(chan struct{})}
+}
+
+// notify wakes up every waiter, must be called with the lock held
+func (ctl *controller) notify() {
+	close(ctl.changed)
+	ctl.changed = make(chan struct{})
+}
+
+func (ctl *controller) pause() {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	ctl.paused = true
+	ctl.steps = 0
+	ctl.notify()
+}
+
+func (ctl *controller) resume() {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	ctl.paused = false
+	ctl.steps = 0
+	ctl.pauseAt = -1
+	ctl.notify()
+}
+
+// setPauseAt pauses the run before its first event due at or after simulated time t
+func (ctl *controller) setPauseAt(t float64) {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	ctl.pauseAt = t
+	ctl.notify()
+}
+
+// step lets n more events through while paused
+func (ctl *controller) step(n int) {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	ctl.paused = true
+	ctl.steps += n
+	ctl.notify()
+}
+
+func (ctl *controller) isPaused() bool {
+	ctl.lock.Lock()
+	defer ctl.lock.Unlock()
+	return ctl.paused
+}
+
+// wait blocks until the next event, due at simulated time t, is allowed to
+// proceed or ctx is cancelled
+func (ctl *controller) wait(ctx context.Context, t float64) error {
+	ctl.lock.Lock()
+	defer func() {
+		if ctl.parked && ctl.onPark != nil {
+			ctl.onPark(false)
+		}
+		ctl.parked = false
+		ctl.lock.Unlock()
+	}()
+	for {
+		if ctl.pauseAt >= 0 && t >= ctl.pauseAt {
+			ctl.paused, ctl.steps, ctl.pauseAt = true, 0, -1
+		}
+		if !ctl.paused {
+			return nil
+		}
+		if ctl.steps > 0 {
+			ctl.steps--
+			return nil
+		}
+		if !ctl.parked {
+			ctl.parked = true
+			if ctl.onPark != nil {
+				ctl.onPark(true)
+			}
+			ctl.notify()
+		}
+		changed := ctl.changed
+		ctl.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			ctl.lock.Lock()
+			return ctx.Err()
+		}
+		ctl.lock.Lock()
+	}
+}
+
+// hold waits until the run is paused between two events, or done, and keeps
+// it there until release is called. It returns false without holding the run
+// if the run is neither paused nor about to pause.
+func (ctl *controller) hold(done <-chan struct{}) bool {
+	for {
+		ctl.lock.Lock()
+		if ctl.parked && ctl.paused && ctl.steps == 0 {
+			return true
+		}
+		if !ctl.paused && ctl.pauseAt < 0 {
+			ctl.lock.Unlock()
+			return false
+		}
+		changed := ctl.changed
+		ctl.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-done:
+			ctl.lock.Lock()
+			return true
+		}
+	}
+}
+
+// release lets a run held by hold continue
+func (ctl *controller) release() {
+	ctl.lock.Unlock()
+}
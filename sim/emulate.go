@@ -0,0 +1,307 @@
+package sim
+
+import (
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// emulationPiece is the number of bytes written or read between two token bucket checks
+const emulationPiece = 16 * 1024
+
+// network moves the chunks of an emulated run over loopback TCP. Every node
+// listens on its own port and serves the chunks it holds, the bytes sent and
+// received by a host go through token buckets refilled at its capacities.
+// Transfers run in their own goroutines and hand finished transfers back to
+// the run, which still owns the swarm.
+type network struct {
+	ctx       context.Context // cancelled when the run returns
+	addrs     map[*Node]string
+	listeners []net.Listener
+	up        map[*hostLink]*tokenBucket
+	down      map[*hostLink]*tokenBucket
+	done      chan *transferHandle
+	errs      chan error
+	wg        sync.WaitGroup
+}
+
+// tokenBucket lets rate bytes per second through, with bursts of at most burst bytes
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := math.Max(rate/50, emulationPiece)
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// take blocks until n bytes may pass, callers waiting together are served in turn
+func (tb *tokenBucket) take(ctx context.Context, n int) error {
+	tb.lock.Lock()
+	now := time.Now()
+	tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	tb.last = now
+	tb.tokens -= float64(n)
+	wait := time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	tb.lock.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startNetwork opens a listener for every node of the swarm
+func (sv *Supervisor) startNetwork(ctx context.Context) (*network, error) {
+	nw := &network{
+		ctx:   ctx,
+		addrs: make(map[*Node]string),
+		up:    make(map[*hostLink]*tokenBucket),
+		down:  make(map[*hostLink]*tokenBucket),
+		done:  make(chan *transferHandle),
+		errs:  make(chan error, 1),
+	}
+	for _, n := range sv.sortedPool() {
+		if _, ok := nw.up[n.link]; !ok {
+			nw.up[n.link] = newTokenBucket(n.MaxUploadBw())
+			nw.down[n.link] = newTokenBucket(n.MaxDownloadBw())
+		}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			nw.close()
+			return nil, err
+		}
+		nw.listeners = append(nw.listeners, l)
+		nw.addrs[n] = l.Addr().String()
+		nw.wg.Add(1)
+		go nw.serve(n, l)
+	}
+	return nw, nil
+}
+
+// close stops every listener and waits for the goroutines of the network,
+// its context must be cancelled first so the connections get closed
+func (nw *network) close() {
+	for _, l := range nw.listeners {
+		l.Close()
+	}
+	nw.wg.Wait()
+}
+
+// watch closes c once the network is cancelled, call the returned function when done with c
+func (nw *network) watch(c net.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-nw.ctx.Done():
+		case <-stop:
+		}
+		c.Close()
+	}()
+	return func() { close(stop) }
+}
+
+// fail reports the first error of a transfer to the run
+func (nw *network) fail(err error) {
+	select {
+	case nw.errs <- err:
+	default:
+	}
+}
+
+// serve uploads the chunks p is asked for
+func (nw *network) serve(p *Node, l net.Listener) {
+	defer nw.wg.Done()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		nw.wg.Add(1)
+		go func() {
+			defer nw.wg.Done()
+			defer nw.watch(c)()
+			if err := nw.upload(p, c); err != nil && nw.ctx.Err() == nil {
+				nw.fail(fmt.Errorf("node %v upload: %v", p.id, err))
+			}
+		}()
+	}
+}
+
+// upload reads a chunk request from c and sends the chunk at the upload capacity of p
+func (nw *network) upload(p *Node, c net.Conn) error {
+	var req [3]uint32
+	if err := binary.Read(c, binary.BigEndian, &req); err != nil {
+		return err
+	}
+	chunk := segfile.ChunkID{SIdx: int(req[0]), RIdx: int(req[1]), CIdx: int(req[2])}
+	if p.sf.Status(chunk) != segfile.Available && !p.sf.IsSegmentComplete(chunk.SIdx) {
+		return fmt.Errorf("chunk %v requested but not held", chunk)
+	}
+	buf := make([]byte, emulationPiece)
+	for sent, size := 0, int(p.sf.ChunkSize); sent < size; {
+		piece := buf[:minInt(emulationPiece, size-sent)]
+		for i := range piece {
+			piece[i] = payloadByte(chunk, sent+i)
+		}
+		if err := nw.up[p.link].take(nw.ctx, len(piece)); err != nil {
+			return err
+		}
+		if _, err := c.Write(piece); err != nil {
+			return err
+		}
+		sent += len(piece)
+	}
+	return nil
+}
+
+// download fetches the chunk of h from its peer at the download capacity of
+// the receiver, checks its content and hands h back to the run
+func (nw *network) download(h *transferHandle) {
+	defer nw.wg.Done()
+	n, chunk := h.n, h.act.Chunk
+	err := func() error {
+		c, err := net.Dial("tcp", nw.addrs[h.act.Peer])
+		if err != nil {
+			return err
+		}
+		defer nw.watch(c)()
+		req := [3]uint32{uint32(chunk.SIdx), uint32(chunk.RIdx), uint32(chunk.CIdx)}
+		if err := binary.Write(c, binary.BigEndian, req); err != nil {
+			return err
+		}
+		buf := make([]byte, emulationPiece)
+		for got, size := 0, int(n.sf.ChunkSize); got < size; {
+			piece := buf[:minInt(emulationPiece, size-got)]
+			if err := nw.down[n.link].take(nw.ctx, len(piece)); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(c, piece); err != nil {
+				return err
+			}
+			for i, b := range piece {
+				if b != payloadByte(chunk, got+i) {
+					return fmt.Errorf("chunk %v corrupted at byte %v", chunk, got+i)
+				}
+			}
+			got += len(piece)
+		}
+		return nil
+	}()
+	if err != nil {
+		if nw.ctx.Err() == nil {
+			nw.fail(fmt.Errorf("node %v download from %v: %v", n.id, h.act.Peer.id, err))
+		}
+		return
+	}
+	select {
+	case nw.done <- h:
+	case <-nw.ctx.Done():
+	}
+}
+
+// payloadByte is byte i of chunk, so receivers can check what they got
+func payloadByte(chunk segfile.ChunkID, i int) byte {
+	return byte(i*7 + chunk.SIdx*131 + chunk.RIdx*17 + chunk.CIdx*3)
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// runEmulation is runEvents for emulated runs: the clock follows the wall
+// clock and transfers finish when their bytes have arrived over the network.
+// A paused run starts no transfer, those already on the wire still move, and
+// the time spent paused does not count. The
+// transfers a stopped run left in flight are sent again from their start.
+func (sv *Supervisor) runEmulation(ctx context.Context, ctl *controller) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	nw, err := sv.startNetwork(ctx)
+	if err != nil {
+		return err
+	}
+	sv.net = nw
+	defer func() {
+		cancel()
+		nw.close()
+		sv.net = nil
+	}()
+	for _, h := range sv.sim.inFlight {
+		sv.emulateTransfer(h)
+	}
+
+	start := time.Now().Add(-time.Duration(sv.sim.clock * float64(time.Second)))
+	for sv.sim.pending > 0 || len(sv.sim.inFlight) > 0 {
+		for len(sv.sim.queue) > 0 && sv.sim.queue[0].cancelled {
+			heap.Pop(&sv.sim.queue)
+		}
+		var due <-chan time.Time
+		if len(sv.sim.queue) > 0 {
+			due = time.After(time.Until(start.Add(time.Duration(sv.sim.queue[0].t * float64(time.Second)))))
+		}
+		select {
+		case <-due:
+			e := sv.sim.queue[0]
+			paused := time.Now()
+			if err := ctl.wait(ctx, e.t); err != nil {
+				return err
+			}
+			// time spent paused does not count
+			start = start.Add(time.Since(paused))
+			heap.Pop(&sv.sim.queue)
+			if !e.background {
+				sv.sim.pending--
+			}
+			sv.sim.clock = math.Max(e.t, time.Since(start).Seconds())
+			e.run()
+			if err := sv.checkAfter(e.describe()); err != nil {
+				return err
+			}
+		case h := <-nw.done:
+			paused := time.Now()
+			if err := ctl.wait(ctx, time.Since(start).Seconds()); err != nil {
+				return err
+			}
+			start = start.Add(time.Since(paused))
+			sv.sim.clock = time.Since(start).Seconds()
+			h.n.finishTransfer(sv, h)
+			if err := sv.checkAfter("a transfer finish"); err != nil {
+				return err
+			}
+		case err := <-nw.errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for _, n := range sv.sim.idle {
+		sv.Printf("%v : Download stalled, no peer can serve the remaining chunks\n", n.id)
+	}
+	return nil
+}
+
+// emulateTransfer sends h over the network instead of scheduling its end
+func (sv *Supervisor) emulateTransfer(h *transferHandle) {
+	sv.net.wg.Add(1)
+	go sv.net.download(h)
+}
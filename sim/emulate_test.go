@@ -0,0 +1,131 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+func emulationScenario() Scenario {
+	sc := DefaultScenario()
+	sc.NumNodes = 6
+	sc.NumSeeders = 1
+	sc.FileSize = 2 * MB
+	sc.ChunkSize = 64 * KB
+	sc.MaxBandwidth = 16 * MB
+	sc.Contention = "fair"
+	sc.Seed = 1
+	sc.Emulate = true
+	return sc
+}
+
+func TestEmulation(t *testing.T) {
+	for _, strategy := range []string{"dyrest", "fast", "flow"} {
+		sc := emulationScenario()
+		sc.Strategy = strategy
+		sc.CheckInvariants = true
+		sm := runScenario(t, sc)
+		if err := sm.Err(); err != nil {
+			t.Errorf("%s: %v", strategy, err)
+		}
+		checkQuiescent(t, strategy, sm)
+		if sm.Supervisor().Now() <= 0 {
+			t.Errorf("%s: Expected the emulated run to take time", strategy)
+		}
+	}
+}
+
+// TestEmulationRestart stops an emulated run with transfers on the wire and
+// starts it again, the transfers are sent again
+func TestEmulationRestart(t *testing.T) {
+	sc := emulationScenario()
+	sc.CheckInvariants = true
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := sm.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		sm.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		sm.Stop()
+		t.Fatal("Expected the restarted run to finish")
+	}
+	if err := sm.Err(); err != nil {
+		t.Error(err)
+	}
+	checkQuiescent(t, "restart", sm)
+}
+
+// TestEmulationPause holds an emulated run paused for longer than the whole
+// run takes, the pause must not count as simulated time
+func TestEmulationPause(t *testing.T) {
+	sc := emulationScenario()
+	end := runScenario(t, sc).Supervisor().Now()
+
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	sm.PauseAt(end / 4)
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for !sm.IsPaused() {
+		time.Sleep(time.Millisecond)
+	}
+	pause := time.Duration(math.Max(2*end, 0.5) * float64(time.Second))
+	time.Sleep(pause)
+	sm.Resume()
+	sm.Wait()
+	if err := sm.Err(); err != nil {
+		t.Fatal(err)
+	}
+	checkQuiescent(t, "pause", sm)
+	if now := sm.Supervisor().Now(); now >= end+pause.Seconds()/2 {
+		t.Errorf("Expected the run to take about %.2f simulated seconds without the %v pause, got %.2f", end, pause, now)
+	}
+}
+
+// TestEmulationCalibration downloads a file from a single seeder one chunk at
+// a time, the emulated and simulated times must be close
+func TestEmulationCalibration(t *testing.T) {
+	sc := emulationScenario()
+	sc.NumNodes, sc.Availability, sc.Contention = 2, 0, "greedy"
+	emulated := runScenario(t, sc).Supervisor().Now()
+	sc.Emulate = false
+	simulated := runScenario(t, sc).Supervisor().Now()
+	if ratio := emulated / simulated; ratio < 0.8 || ratio > 1.5 {
+		t.Errorf("Expected the emulation to take about %.2f seconds, got %.2f", simulated, emulated)
+	}
+}
+
+func TestEmulationCheckpoint(t *testing.T) {
+	sc := emulationScenario()
+	sc.EndgameThreshold = 5
+	if err := NewManager(nil).Initialize(sc); err == nil {
+		t.Error("Expected endgame mode to be refused in emulation")
+	}
+
+	sm := runScenario(t, emulationScenario())
+	if _, err := sm.Checkpoint(); err == nil {
+		t.Error("Expected an emulated run not to be checkpointed")
+	}
+}
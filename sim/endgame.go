@@ -0,0 +1,52 @@
+package sim
+
+import (
+	"sort"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// planEndgame returns extra requests for chunks n already has in flight, from
+// other peers, so the last chunks do not wait on a single slow transfer. Each
+// chunk gets at most endgameDuplicates extra copies, taken from the fastest
+// peers that can serve it. Like planActions every action is reserved before
+// the next one is chosen.
+func (sv *Supervisor) planEndgame(n *Node) []Action {
+	chunks := make([]segfile.ChunkID, 0, len(n.transfers))
+	for chkId := range n.transfers {
+		chunks = append(chunks, chkId)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		a, b := chunks[i], chunks[j]
+		if a.SIdx != b.SIdx {
+			return a.SIdx < b.SIdx
+		}
+		if a.RIdx != b.RIdx {
+			return a.RIdx < b.RIdx
+		}
+		return a.CIdx < b.CIdx
+	})
+
+	minBw := n.MaxDownloadBw() * MinTransferShare
+	var acts []Action
+	for _, chkId := range chunks {
+		serving := make(map[*Node]bool)
+		for _, h := range n.transfers[chkId] {
+			serving[h.act.Peer] = true
+		}
+		for copies := len(n.transfers[chkId]); copies <= sv.endgameDuplicates; copies++ {
+			if n.InFlight() >= sv.maxInFlight {
+				return acts
+			}
+			best, bestBw := sv.fastestHolder(n, chkId, 0, serving)
+			if best == nil || bestBw < minBw {
+				break
+			}
+			serving[best] = true
+			act := Action{best, chkId, bestBw}
+			n.prepareDuplicate(act)
+			acts = append(acts, act)
+		}
+	}
+	return acts
+}
@@ -0,0 +1,80 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// startEndgame puts count missing chunks of n in flight from its first peer
+// and returns the supervisor set to request one more copy of each
+func startEndgame(sv *Supervisor, n *Node, count int) {
+	sv.endgameDuplicates = 1
+	sv.maxInFlight = 2 * count
+	var peer *Node
+	for _, p := range sv.sortedPool() {
+		if p.complete {
+			peer = p
+			break
+		}
+	}
+	for idx := 0; count > 0; idx++ {
+		chk := n.sf.DataChunk(idx)
+		if n.sf.Status(chk) != segfile.NotAvailable {
+			continue
+		}
+		count--
+		act := Action{peer, chk, 0}
+		n.PrepareTransfer(act)
+		n.transfers[chk] = []*transferHandle{{n: n, act: act}}
+	}
+}
+
+// undoDuplicates releases what planEndgame reserved for acts
+func undoDuplicates(n *Node, acts []Action) {
+	for _, act := range acts {
+		n.connLock.Lock()
+		if n.connectedNodes[act.Peer]--; n.connectedNodes[act.Peer] <= 0 {
+			delete(n.connectedNodes, act.Peer)
+		}
+		n.connLock.Unlock()
+		n.currentDownloadBw.release(act.Bw)
+		act.Peer.currentUploadBw.release(act.Bw)
+	}
+}
+
+func TestPlanEndgame(t *testing.T) {
+	sv, n := initializeBenchSupervisor(100)
+	startEndgame(sv, n, 5)
+
+	acts := sv.planEndgame(n)
+	if len(acts) == 0 {
+		t.Fatal("Expected second copies of the chunks in flight")
+	}
+	for _, act := range acts {
+		if act.Peer == n.transfers[act.Chunk][0].act.Peer || n.sf.Status(act.Chunk) != segfile.PartiallyAvailable {
+			t.Errorf("Expected chunk %v in flight to come from another peer, got %v", act.Chunk, act.Peer.id)
+		}
+		// no peer offers a faster copy
+		for _, p := range sv.Nodes() {
+			if p != act.Peer && p != n.transfers[act.Chunk][0].act.Peer && sv.CanConnect(n, p) &&
+				(sv.VisibleStatus(n, p, act.Chunk) == segfile.Available || (act.Chunk.RIdx > 0 && sv.CanGenerate(n, p, act.Chunk.SIdx))) {
+				undoDuplicates(n, []Action{act})
+				bw := sv.Bandwidth(n, p)
+				n.prepareDuplicate(act)
+				if bw > act.Bw+1e-9 {
+					t.Errorf("Expected the copy of chunk %v at %.0f, node %v offers %.0f", act.Chunk, act.Bw, p.id, bw)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkEndgame(b *testing.B) {
+	benchmarkDecision(b, func(sv *Supervisor, n *Node, i int) {
+		if len(n.transfers) == 0 {
+			startEndgame(sv, n, 5)
+		}
+		undoDuplicates(n, sv.planEndgame(n))
+	})
+}
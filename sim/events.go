@@ -0,0 +1,214 @@
+package sim
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// event is something happening at simulated time t. Events due at the same
+// time run in the order they were scheduled, so a run only depends on its seed.
+// Transfers ending at the same time come first, ordered by node and chunk, so
+// the workers of a distributed run see them in the same order as a single process.
+type event struct {
+	t          float64
+	seq        int
+	run        func()
+	cancelled  bool
+	background bool // background events, like bandwidth traces, do not keep a run going
+
+	// what run does, so checkpoints can schedule the event again
+	kind  int
+	n     *Node           // node deciding or receiving, or a node of the host following a trace
+	chunk segfile.ChunkID // chunk received
+	point int             // trace point applied
+}
+
+const (
+	eventDecision int = iota
+	eventFinish
+	eventTrace
+	eventArrival   // chunk received by a node of another worker
+	eventDeparture // seeder leaving after its seeding time
+)
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+
+func (q eventQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.t != b.t {
+		return a.t < b.t
+	}
+	if ea, eb := a.endsTransfer(), b.endsTransfer(); ea != eb {
+		return ea
+	} else if ea {
+		if a.n.id != b.n.id {
+			return a.n.id < b.n.id
+		}
+		if a.chunk != b.chunk {
+			return a.chunk.Less(b.chunk)
+		}
+	}
+	return a.seq < b.seq
+}
+
+// endsTransfer tells whether e delivers a chunk, locally or from another worker
+func (e *event) endsTransfer() bool {
+	return e.kind == eventFinish || e.kind == eventArrival
+}
+
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
+
+// simulation is the state of a run. A run is a single goroutine executing
+// events one at a time, it owns every node, segfile, transfer and link of the
+// swarm until it returns. Other goroutines only reach the simulation through
+// the simulation manager, the controller and the event log.
+type simulation struct {
+	clock       float64 // simulated seconds since the start of the run
+	queue       eventQueue
+	seq         int
+	pending     int     // scheduled foreground events
+	downloading int     // nodes that have not completed yet
+	idle        []*Node // downloading nodes waiting for the swarm to change
+	inFlight    []*transferHandle
+	speed       float64 // simulated seconds per wall clock second, 0 runs as fast as possible
+}
+
+// Now returns the virtual time of the simulation in seconds
+func (sv *Supervisor) Now() float64 {
+	return sv.sim.clock
+}
+
+// schedule runs f at simulated time t
+func (sv *Supervisor) schedule(t float64, background bool, f func()) *event {
+	e := &event{t: t, seq: sv.sim.seq, run: f, background: background}
+	sv.sim.seq++
+	sv.push(e)
+	return e
+}
+
+// push adds e to the queue, keeping its sequence number
+func (sv *Supervisor) push(e *event) {
+	if !e.background {
+		sv.sim.pending++
+	}
+	heap.Push(&sv.sim.queue, e)
+}
+
+func (sv *Supervisor) cancelEvent(e *event) {
+	if e == nil || e.cancelled {
+		return
+	}
+	e.cancelled = true
+	if !e.background {
+		sv.sim.pending--
+	}
+}
+
+// startRun schedules the traces and the first decision of every downloading node
+func (sv *Supervisor) startRun() {
+	speed := sv.sim.speed
+	sv.sim = simulation{speed: speed}
+
+	for _, h := range sv.traceHosts() {
+		sv.scheduleTrace(sv.hosts[h], sv.traces[h])
+	}
+	nodes := sv.sortedPool()
+	for _, n := range nodes {
+		if n.complete {
+			sv.scheduleDeparture(n, sv.seeding.LeaveTime)
+		}
+		if !n.complete && sv.owns(n) {
+			sv.Printf("%v : ====== Starting node transfer ======\n", n.id)
+			sv.sim.downloading++
+			sv.scheduleDecision(n)
+		}
+	}
+}
+
+func (sv *Supervisor) scheduleDecision(n *Node) {
+	e := sv.schedule(sv.Now(), false, func() { n.decide(sv) })
+	e.kind, e.n = eventDecision, n
+}
+
+// wait makes n sleep until another node makes progress
+func (sv *Supervisor) wait(n *Node) {
+	sv.sim.idle = append(sv.sim.idle, n)
+}
+
+// wakeIdle lets every waiting node decide again, the swarm has changed
+func (sv *Supervisor) wakeIdle() {
+	for _, n := range sv.sim.idle {
+		sv.scheduleDecision(n)
+	}
+	sv.sim.idle = sv.sim.idle[:0]
+}
+
+// runEvents executes the events of the run in order until none are left, ctl
+// gates every event. With a speed set, events are held back until the wall
+// clock catches up with them, time spent paused does not count.
+func (sv *Supervisor) runEvents(ctx context.Context, ctl *controller) error {
+	base, start := time.Now(), sv.sim.clock
+	for sv.sim.pending > 0 {
+		for sv.sim.queue[0].cancelled {
+			heap.Pop(&sv.sim.queue)
+		}
+		// the next event stays queued until it runs, so a paused or stopped
+		// run can be checkpointed between two events
+		e := sv.sim.queue[0]
+		paused := time.Now()
+		if err := ctl.wait(ctx, e.t); err != nil {
+			return err
+		}
+		base = base.Add(time.Since(paused))
+		if sv.sim.speed > 0 {
+			due := base.Add(time.Duration((e.t - start) / sv.sim.speed * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		heap.Pop(&sv.sim.queue)
+		if !e.background {
+			sv.sim.pending--
+		}
+		sv.sim.clock = e.t
+		e.run()
+		if err := sv.checkAfter(e.describe()); err != nil {
+			return err
+		}
+	}
+	// nothing left can wake the waiting nodes
+	for _, n := range sv.sim.idle {
+		sv.Printf("%v : Download stalled, no peer can serve the remaining chunks\n", n.id)
+	}
+	return nil
+}
+
+func (sv *Supervisor) addInFlight(h *transferHandle) {
+	sv.sim.inFlight = append(sv.sim.inFlight, h)
+}
+
+func (sv *Supervisor) removeInFlight(h *transferHandle) {
+	for i, f := range sv.sim.inFlight {
+		if f == h {
+			sv.sim.inFlight = append(sv.sim.inFlight[:i], sv.sim.inFlight[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package sim
+
+import "fmt"
+
+// Leftovers lists what a finished run left behind: nodes that did not
+// complete, transfers, pending events and bandwidth reservations
+func Leftovers(sm *Manager) []string {
+	var problems []string
+	sv := &sm.supervisor
+	if len(sv.sim.inFlight) > 0 || sv.sim.pending > 0 || sv.sim.downloading > 0 {
+		problems = append(problems, fmt.Sprintf("%v transfers, %v events and %v downloads left", len(sv.sim.inFlight), sv.sim.pending, sv.sim.downloading))
+	}
+	for _, n := range sv.Nodes() {
+		if !n.complete || !n.sf.PlannedComplete() || n.sf.TotalRemaining() > 0 {
+			problems = append(problems, fmt.Sprintf("node %v did not complete", n.id))
+		}
+		if len(n.transfers) > 0 || n.sf.TransferInProgress() || n.InFlight() > 0 || len(n.connectedNodes) > 0 {
+			problems = append(problems, fmt.Sprintf("node %v has transfers left", n.id))
+		}
+		if n.currentDownloadBw.get() > 1e-3 || n.currentUploadBw.get() > 1e-3 {
+			problems = append(problems, fmt.Sprintf("host %v has bandwidth reserved", n.host))
+		}
+	}
+	return problems
+}
+
+// IsPaused reports whether the controller of sm holds the run
+func (sm *Manager) IsPaused() bool {
+	return sm.controller.isPaused()
+}
+
+// LeakUpload reserves bw of the upload bandwidth of node id without a
+// transfer, the way a missed release would
+func LeakUpload(sm *Manager, id int, bw float64) {
+	for _, n := range sm.supervisor.Nodes() {
+		if n.id == id {
+			n.currentUploadBw.reserve(bw)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package sim_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the scenario tests")
+
+// event is a message of the event log with its data left encoded
+type event struct {
+	Code int
+	Data json.RawMessage
+}
+
+// recordScenario runs sc and returns the events it logged
+func recordScenario(t *testing.T, sc Scenario) (*Manager, []event) {
+	sc.Speed = 0
+	events := make(chan []byte)
+	var log []event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range events {
+			var e event
+			if err := json.Unmarshal(msg, &e); err != nil {
+				t.Error(err)
+			}
+			log = append(log, e)
+		}
+	}()
+	sm := NewManager(events)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	close(events)
+	<-done
+	return sm, log
+}
+
+func decode(t *testing.T, e event, data interface{}) {
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// render writes the events that matter for the outcome of a run, one per
+// line, followed by the completion time of every node
+func render(t *testing.T, sm *Manager, log []event) []byte {
+	var buf bytes.Buffer
+	for _, e := range log {
+		switch e.Code {
+		case MessageNodeAdded:
+			var d NodeData
+			decode(t, e, &d)
+			fmt.Fprintf(&buf, "node %v host %v file %v down %.0f up %.0f\n", d.Id, d.Host, d.File, d.MaxDownloadBw, d.MaxUploadBw)
+		case MessageTransferStarted, MessageTransferFinished, MessageTransferCancelled:
+			var d TransferData
+			decode(t, e, &d)
+			verb := map[int]string{MessageTransferStarted: "start", MessageTransferFinished: "finish", MessageTransferCancelled: "cancel"}[e.Code]
+			fmt.Fprintf(&buf, "%.6f %s %v <- %v s%v r%v c%v %.0f\n", d.Time, verb, d.To, d.From, d.Chunk.Seg, d.Chunk.R, d.Chunk.Idx, d.Bandwidth)
+		case MessageNodeLeft:
+			var d NodeLeftData
+			decode(t, e, &d)
+			fmt.Fprintf(&buf, "%.6f left %v after %.0f bytes, %s\n", d.Time, d.Id, d.UploadedBytes, d.Reason)
+		case MessagePlayback:
+			var d PlaybackData
+			decode(t, e, &d)
+			fmt.Fprintf(&buf, "%.6f playback %v %s s%v %.6f\n", d.Time, d.Id, d.Event, d.Segment, d.Duration)
+		case MessageSimulationState:
+			var d SimulationStateData
+			decode(t, e, &d)
+			fmt.Fprintf(&buf, "state %s\n", d.State)
+		}
+	}
+	for _, n := range sm.Supervisor().Nodes() {
+		fmt.Fprintf(&buf, "node %v completed at %.6f\n", n.ID(), n.CompletedAt())
+	}
+	return buf.Bytes()
+}
+
+// goldenScenarios are small seeded runs whose event logs are kept in testdata,
+// run go test -update after a change meant to alter them
+var goldenScenarios = map[string]func(sc *Scenario){
+	"dyrest":  func(sc *Scenario) {},
+	"fast":    func(sc *Scenario) { sc.Strategy = "fast" },
+	"flow":    func(sc *Scenario) { sc.Strategy = "flow" },
+	"endgame": func(sc *Scenario) { sc.EndgameThreshold = 3 },
+	"stream":  func(sc *Scenario) { sc.Streaming.Enabled = true; sc.Streaming.Lookahead = 2 },
+	"files":   func(sc *Scenario) { sc.Files = []FileSpec{{4 * MB, 1, 1}, {2 * MB, 1, 0.5}} },
+	"rounds":  func(sc *Scenario) { sc.Rounds = true },
+}
+
+func TestGoldenScenarios(t *testing.T) {
+	for name, setup := range goldenScenarios {
+		sc := DefaultScenario()
+		sc.NumNodes = 4
+		sc.FileSize = 4 * MB
+		sc.Seed = 42
+		setup(&sc)
+		sm, log := recordScenario(t, sc)
+		got := render(t, sm, log)
+
+		path := filepath.Join("testdata", name+".golden")
+		if *update {
+			if err := ioutil.WriteFile(path, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: Event log differs from %s, run go test -update if the change is intended\n%s", name, path, firstDifference(want, got))
+		}
+	}
+}
+
+// firstDifference returns the first line where got differs from want
+func firstDifference(want []byte, got []byte) string {
+	wantLines, gotLines := bytes.Split(want, []byte("\n")), bytes.Split(got, []byte("\n"))
+	for i := 0; i < len(wantLines) && i < len(gotLines); i++ {
+		if !bytes.Equal(wantLines[i], gotLines[i]) {
+			return fmt.Sprintf("line %v: expected %q, got %q", i+1, wantLines[i], gotLines[i])
+		}
+	}
+	return fmt.Sprintf("expected %v lines, got %v", len(wantLines), len(gotLines))
+}
@@ -0,0 +1,254 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// HolderIndex records which nodes of a swarm hold each chunk so the strategies
+// find the uploaders of a chunk without scanning the pool. Only nodes added to
+// the supervisor are indexed, SetChunk keeps their entries up to date. The
+// holders of a chunk are ordered by the fastest rate they could upload at, so
+// a search can stop at the first holder unable to beat the best one found.
+type HolderIndex struct {
+	lock     sync.RWMutex
+	bounds   map[*Node]float64 // upper bound of the upload rate of every indexed node
+	held     map[*Node][]bool  // lists every indexed node is in
+	lists    []holderList
+	chunks   [][][]int // list of every chunk by segment, redundancy level and chunk index
+	complete []int     // list of the holders of every whole segment, they can generate any parity chunk
+	unsorted []int     // lists appended to since they were last sorted
+}
+
+type holderList struct {
+	nodes  []*Node // by decreasing bound while sorted
+	sorted bool
+}
+
+func newHolderIndex(sfinfo *segfile.Info) *HolderIndex {
+	hi := HolderIndex{
+		bounds:   make(map[*Node]float64),
+		held:     make(map[*Node][]bool),
+		chunks:   make([][][]int, sfinfo.NumSegments),
+		complete: make([]int, sfinfo.NumSegments),
+	}
+	for sIdx := range hi.chunks {
+		hi.chunks[sIdx] = make([][]int, sfinfo.NumLevels()+1)
+		for rIdx := range hi.chunks[sIdx] {
+			hi.chunks[sIdx][rIdx] = make([]int, sfinfo.LevelSize(sIdx, rIdx))
+			for cIdx := range hi.chunks[sIdx][rIdx] {
+				hi.chunks[sIdx][rIdx][cIdx] = len(hi.lists)
+				hi.lists = append(hi.lists, holderList{sorted: true})
+			}
+		}
+		hi.complete[sIdx] = len(hi.lists)
+		hi.lists = append(hi.lists, holderList{sorted: true})
+	}
+	return &hi
+}
+
+// register indexes every chunk n holds, bound is the fastest rate n could upload at
+func (hi *HolderIndex) register(n *Node, bound float64) {
+	n.sf.OnAvailable(func(chkId segfile.ChunkID, segmentComplete bool) {
+		hi.chunkAvailable(n, chkId, segmentComplete)
+	})
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	hi.bounds[n] = bound
+	hi.held[n] = make([]bool, len(hi.lists))
+	for sIdx, seg := range n.sf.Availability() {
+		for rIdx, chunks := range seg {
+			for cIdx, status := range chunks {
+				if status == segfile.Available {
+					hi.add(hi.chunks[sIdx][rIdx][cIdx], n, false)
+				}
+			}
+		}
+		if n.sf.IsSegmentComplete(sIdx) {
+			hi.add(hi.complete[sIdx], n, false)
+		}
+	}
+}
+
+func (hi *HolderIndex) unregister(n *Node) {
+	n.sf.OnAvailable(nil)
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	for i, held := range hi.held[n] {
+		if !held {
+			continue
+		}
+		l := &hi.lists[i]
+		for j, p := range l.nodes {
+			if p == n {
+				l.nodes = append(l.nodes[:j], l.nodes[j+1:]...)
+				break
+			}
+		}
+	}
+	delete(hi.bounds, n)
+	delete(hi.held, n)
+}
+
+// add must be called with the lock held. A sorted list stays sorted if keepSorted is set,
+// otherwise n is appended and the list sorted on the next search.
+func (hi *HolderIndex) add(list int, n *Node, keepSorted bool) {
+	if hi.held[n][list] {
+		return
+	}
+	hi.held[n][list] = true
+	l := &hi.lists[list]
+	if !keepSorted || !l.sorted {
+		if l.sorted {
+			l.sorted = false
+			hi.unsorted = append(hi.unsorted, list)
+		}
+		l.nodes = append(l.nodes, n)
+		return
+	}
+	bound := hi.bounds[n]
+	i := sort.Search(len(l.nodes), func(i int) bool { return hi.bounds[l.nodes[i]] < bound })
+	l.nodes = append(l.nodes, nil)
+	copy(l.nodes[i+1:], l.nodes[i:])
+	l.nodes[i] = n
+}
+
+// chunkAvailable records that n holds chkId, and every data chunk of its
+// segment when the segment is complete
+func (hi *HolderIndex) chunkAvailable(n *Node, chkId segfile.ChunkID, segmentComplete bool) {
+	hi.lock.Lock()
+	defer hi.lock.Unlock()
+	if _, ok := hi.held[n]; !ok {
+		return
+	}
+	hi.add(hi.chunks[chkId.SIdx][chkId.RIdx][chkId.CIdx], n, true)
+	if segmentComplete {
+		for _, list := range hi.chunks[chkId.SIdx][0] {
+			hi.add(list, n, true)
+		}
+		hi.add(hi.complete[chkId.SIdx], n, true)
+	}
+}
+
+// rLockSorted read locks the index once every list is sorted
+func (hi *HolderIndex) rLockSorted() {
+	hi.lock.RLock()
+	for len(hi.unsorted) > 0 {
+		hi.lock.RUnlock()
+		hi.lock.Lock()
+		for _, list := range hi.unsorted {
+			l := &hi.lists[list]
+			sort.SliceStable(l.nodes, func(i, j int) bool { return hi.bounds[l.nodes[i]] > hi.bounds[l.nodes[j]] })
+			l.sorted = true
+		}
+		hi.unsorted = hi.unsorted[:0]
+		hi.lock.Unlock()
+		hi.lock.RLock()
+	}
+}
+
+// each calls f for every node of a list by decreasing bound until f returns false
+func (hi *HolderIndex) each(list int, f func(p *Node, bound float64) bool) {
+	hi.rLockSorted()
+	defer hi.lock.RUnlock()
+	for _, p := range hi.lists[list].nodes {
+		if !f(p, hi.bounds[p]) {
+			return
+		}
+	}
+}
+
+// EachHolder calls f for every node holding chkId, by decreasing bound, until
+// f returns false. f must not use the index.
+func (hi *HolderIndex) EachHolder(chkId segfile.ChunkID, f func(p *Node, bound float64) bool) {
+	hi.each(hi.chunks[chkId.SIdx][chkId.RIdx][chkId.CIdx], f)
+}
+
+// EachHolderFrom calls f for every node holding chkId, starting at a random
+// one and wrapping around, until f returns false. Searches taking the first
+// suitable holder use it to spread their load. f must not use the index.
+func (hi *HolderIndex) EachHolderFrom(chkId segfile.ChunkID, rng *rand.Rand, f func(p *Node) bool) {
+	hi.lock.RLock()
+	defer hi.lock.RUnlock()
+	nodes := hi.lists[hi.chunks[chkId.SIdx][chkId.RIdx][chkId.CIdx]].nodes
+	if len(nodes) == 0 {
+		return
+	}
+	start := rng.Intn(len(nodes))
+	for i := range nodes {
+		if !f(nodes[(start+i)%len(nodes)]) {
+			return
+		}
+	}
+}
+
+// EachComplete calls f for every node holding the whole segment sIdx, by
+// decreasing bound, until f returns false. f must not use the index.
+func (hi *HolderIndex) EachComplete(sIdx int, f func(p *Node, bound float64) bool) {
+	hi.each(hi.complete[sIdx], f)
+}
+
+// CountDataHolders returns the number of nodes holding every data chunk, by segment and chunk index
+func (hi *HolderIndex) CountDataHolders() [][]int {
+	hi.lock.RLock()
+	defer hi.lock.RUnlock()
+	counts := make([][]int, len(hi.chunks))
+	for sIdx := range hi.chunks {
+		counts[sIdx] = make([]int, len(hi.chunks[sIdx][0]))
+		for cIdx, list := range hi.chunks[sIdx][0] {
+			counts[sIdx][cIdx] = len(hi.lists[list].nodes)
+		}
+	}
+	return counts
+}
+
+// fastestHolder returns the peer n would get chkId from at the highest rate
+// above floor, skipping the peers in skip, or nil if none is faster. Holders
+// are searched by decreasing rate bound and the search stops at the first one
+// unable to beat the best found, parity chunks can also be generated by the
+// holders of the whole segment.
+func (sv *Supervisor) fastestHolder(n *Node, chkId segfile.ChunkID, floor float64, skip map[*Node]bool) (*Node, float64) {
+	// bounds only hold while capacities are fixed
+	pruning := !sv.Tracing()
+	var best *Node
+	bestBw := floor
+	consider := func(p *Node, bound float64) bool {
+		if pruning && bound <= bestBw {
+			return false
+		}
+		if !skip[p] && sv.CanConnect(n, p) {
+			if bw := sv.Bandwidth(n, p); bw > bestBw {
+				best, bestBw = p, bw
+			}
+		}
+		return true
+	}
+
+	var superSeeders []*Node
+	n.holders.EachHolder(chkId, func(p *Node, bound float64) bool {
+		if p.seeder.isSuperSeeding() {
+			superSeeders = append(superSeeders, p)
+			return true
+		}
+		return consider(p, bound)
+	})
+	// a super-seeder only shows n one chunk, it is checked apart from the pruned search
+	for _, p := range superSeeders {
+		if sv.VisibleStatus(n, p, chkId) == segfile.Available {
+			consider(p, math.Inf(1))
+		}
+	}
+	if chkId.RIdx > 0 {
+		n.holders.EachComplete(chkId.SIdx, func(p *Node, bound float64) bool {
+			if !sv.CanGenerate(n, p, chkId.SIdx) {
+				return true
+			}
+			return consider(p, bound)
+		})
+	}
+	return best, bestBw
+}
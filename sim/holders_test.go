@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// initializeBenchSupervisor builds a swarm of numNodes leechers holding 40% of
+// a 100 MB file each, served by 10 seeders
+func initializeBenchSupervisor(numNodes int) (*Supervisor, *Node) {
+	sv := initializeTestSupervisor()
+	sv.rng = rand.New(rand.NewSource(1))
+	segfileInfo, _ := segfile.NewInfo(100*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	var n *Node
+	for i := 0; i < numNodes; i++ {
+		ratio := 0.4
+		if i < 10 {
+			ratio = 1
+		}
+		n = sv.NewNode(segfileInfo, 10*MB, 0.632, ratio)
+		sv.AddNode(n)
+	}
+	return sv, n
+}
+
+// benchmarkDecision runs decide against swarms of growing size
+func benchmarkDecision(b *testing.B, decide func(sv *Supervisor, n *Node, i int)) {
+	for _, numNodes := range []int{100, 1000, 10000} {
+		sv, n := initializeBenchSupervisor(numNodes)
+		b.Run(fmt.Sprintf("nodes=%d", numNodes), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				decide(sv, n, i)
+			}
+		})
+	}
+}
+
+func TestHolderIndex(t *testing.T) {
+	sv, n := initializeBenchSupervisor(50)
+	chk := segfile.ChunkID{SIdx: 0, RIdx: 1, CIdx: 0}
+	n.sf.SetChunk(chk, segfile.PartiallyAvailable)
+	n.sf.SetChunk(chk, segfile.Available)
+
+	for sIdx := 0; sIdx < n.sf.NumSegments; sIdx++ {
+		for rIdx := 0; rIdx <= n.sf.NumLevels(); rIdx++ {
+			for cIdx := 0; cIdx < n.sf.LevelSize(sIdx, rIdx); cIdx++ {
+				chk := segfile.ChunkID{SIdx: sIdx, RIdx: rIdx, CIdx: cIdx}
+				holders := make(map[*Node]struct{})
+				prev := math.Inf(1)
+				n.holders.EachHolder(chk, func(p *Node, bound float64) bool {
+					if bound > prev {
+						t.Fatalf("Expected holders of %v by decreasing bound", chk)
+					}
+					holders[p], prev = struct{}{}, bound
+					return true
+				})
+				for p := range sv.pool {
+					if _, ok := holders[p]; ok != (p.sf.Status(chk) == segfile.Available) {
+						t.Fatalf("Expected node %v in the holders of %v: %v", p.id, chk, !ok)
+					}
+				}
+			}
+		}
+	}
+
+	sv.RemoveNode(n)
+	n.holders.EachHolder(chk, func(p *Node, bound float64) bool {
+		if p == n {
+			t.Error("Expected a removed node to leave the index")
+		}
+		return true
+	})
+}
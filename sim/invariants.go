@@ -0,0 +1,168 @@
+package sim
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// InvariantError stops a run checking its invariants at the first event
+// leaving the simulation in an inconsistent state
+type InvariantError struct {
+	Time     float64
+	Event    string
+	Problems []string
+	Dump     string // state of every node and transfer after the event
+}
+
+func (e *InvariantError) Error() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "invariants violated at %.6f after %s:", e.Time, e.Event)
+	for _, p := range e.Problems {
+		fmt.Fprintf(&buf, "\n  %s", p)
+	}
+	buf.WriteString("\n")
+	buf.WriteString(e.Dump)
+	return buf.String()
+}
+
+// describe names e for diagnostics
+func (e *event) describe() string {
+	switch e.kind {
+	case eventFinish:
+		return "a transfer finish"
+	case eventTrace:
+		return fmt.Sprintf("trace point %v of host %v", e.point, e.n.host)
+	case eventArrival:
+		return "an arrival from another worker"
+	case eventDeparture:
+		return fmt.Sprintf("the departure of node %v", e.n.id)
+	}
+	return fmt.Sprintf("a decision of node %v", e.n.id)
+}
+
+// checkAfter checks the invariants of the run once what happened, if the scenario asks for it
+func (sv *Supervisor) checkAfter(what string) error {
+	if !sv.checking {
+		return nil
+	}
+	problems := sv.checkInvariants()
+	if len(problems) == 0 {
+		return nil
+	}
+	var dump bytes.Buffer
+	sv.dumpState(&dump)
+	return &InvariantError{sv.Now(), what, problems, dump.String()}
+}
+
+// checkInvariants returns what is inconsistent between the nodes, their
+// segfiles and the transfers in flight
+func (sv *Supervisor) checkInvariants() []string {
+	var problems []string
+	nodes := sv.Nodes()
+
+	// bandwidth is accounted per host, the nodes of a host share it
+	reserved := make(map[*bandwidth]float64)
+	rates := make(map[*bandwidth]float64)
+	transfers := make(map[*bandwidth]int)
+	connections := make(map[*Node]map[*Node]int)
+	for _, h := range sv.sim.inFlight {
+		n, p := h.n, h.act.Peer
+		for _, bw := range []*bandwidth{n.currentDownloadBw, p.currentUploadBw} {
+			reserved[bw] += h.act.Bw
+			rates[bw] += h.rate
+			transfers[bw]++
+		}
+		if connections[n] == nil {
+			connections[n] = make(map[*Node]int)
+		}
+		connections[n][p]++
+		if status := n.sf.Status(h.act.Chunk); status != segfile.PartiallyAvailable {
+			problems = append(problems, fmt.Sprintf("node %v: chunk %v in flight has status %v", n.id, h.act.Chunk, status))
+		}
+		found := false
+		for _, t := range n.transfers[h.act.Chunk] {
+			found = found || t == h
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("node %v: transfer of chunk %v from %v not recorded", n.id, h.act.Chunk, p.id))
+		}
+	}
+
+	// uploads to the nodes of other workers have no transfer here
+	remote := make(map[*bandwidth]float64)
+	if sv.part != nil {
+		for bw, r := range sv.part.remote {
+			reserved[bw] += r.bw
+			transfers[bw] += r.transfers
+			remote[bw] = r.bw
+		}
+	}
+
+	checked := make(map[*bandwidth]bool)
+	downloading := 0
+	for _, n := range nodes {
+		if err := n.sf.Check(); err != nil {
+			problems = append(problems, fmt.Sprintf("node %v: %v", n.id, err))
+		}
+		if !n.complete && sv.owns(n) {
+			downloading++
+		}
+		for p, count := range n.connectedNodes {
+			if connections[n][p] != count {
+				problems = append(problems, fmt.Sprintf("node %v: %v connections to %v, %v transfers in flight", n.id, count, p.id, connections[n][p]))
+			}
+		}
+		if len(n.connectedNodes) != len(connections[n]) {
+			problems = append(problems, fmt.Sprintf("node %v: connected to %v peers, downloading from %v", n.id, len(n.connectedNodes), len(connections[n])))
+		}
+
+		for _, c := range []struct {
+			dir      string
+			bw       *bandwidth
+			capacity float64
+		}{{"download", n.currentDownloadBw, n.MaxDownloadBw()}, {"upload", n.currentUploadBw, n.MaxUploadBw()}} {
+			if checked[c.bw] {
+				continue
+			}
+			checked[c.bw] = true
+			value, count := c.bw.get(), c.bw.getTransfers()
+			tolerance := 1e-6 * math.Max(1, c.capacity)
+			if math.Abs(value-reserved[c.bw]) > tolerance || count != transfers[c.bw] {
+				problems = append(problems, fmt.Sprintf("host %v: %.0f bytes/s %s reserved by %v transfers, %.0f by %v in flight", n.host, value, c.dir, count, reserved[c.bw], transfers[c.bw]))
+			}
+			if value < -tolerance {
+				problems = append(problems, fmt.Sprintf("host %v: negative %s reservation %.0f", n.host, c.dir, value))
+			}
+			// a shrinking capacity throttles the rates of the transfers reserved above it,
+			// the uploads of other workers are reserved late and may overlap local ones
+			used := value - remote[c.bw]
+			if sv.Tracing() {
+				used = rates[c.bw]
+			}
+			if used > c.capacity+tolerance {
+				problems = append(problems, fmt.Sprintf("host %v: %s at %.0f bytes/s over its capacity %.0f", n.host, c.dir, used, c.capacity))
+			}
+		}
+	}
+	if downloading != sv.sim.downloading {
+		problems = append(problems, fmt.Sprintf("%v nodes downloading, %v counted", downloading, sv.sim.downloading))
+	}
+	return problems
+}
+
+// dumpState writes the state of every node and transfer in flight
+func (sv *Supervisor) dumpState(w *bytes.Buffer) {
+	for _, n := range sv.Nodes() {
+		fmt.Fprintf(w, "node %v host %v file %v complete %v remaining %v: down %.0f/%.0f by %v transfers, up %.0f/%.0f by %v transfers\n",
+			n.id, n.host, n.file, n.complete, n.sf.TotalRemaining(),
+			n.currentDownloadBw.get(), n.MaxDownloadBw(), n.InFlight(),
+			n.currentUploadBw.get(), n.MaxUploadBw(), n.Uploads())
+	}
+	for _, h := range sv.sim.inFlight {
+		fmt.Fprintf(w, "transfer %v <- %v chunk %v: reserved %.0f, rate %.0f, %.0f bytes left at %.6f\n",
+			h.n.id, h.act.Peer.id, h.act.Chunk, h.act.Bw, h.rate, h.remaining, h.updated)
+	}
+}
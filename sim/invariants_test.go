@@ -0,0 +1,59 @@
+package sim_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+func TestInvariants(t *testing.T) {
+	for name, mod := range stressScenarios {
+		for _, strategy := range []string{"dyrest", "fast", "adaptive", "flow"} {
+			sc := DefaultScenario()
+			sc.NumNodes = 20
+			sc.NumSeeders = 2
+			sc.Strategy = strategy
+			sc.Seed = 2
+			sc.CheckInvariants = true
+			mod(&sc)
+			sm := runScenario(t, sc)
+			if err := sm.Err(); err != nil {
+				t.Errorf("%s/%s: %v", name, strategy, err)
+			}
+			checkQuiescent(t, fmt.Sprintf("%s/%s", name, strategy), sm)
+		}
+	}
+}
+
+func TestInvariantViolation(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 10
+	sc.Seed = 2
+	sc.Speed = 0
+	sc.CheckInvariants = true
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	LeakUpload(sm, 0, 1000)
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+
+	err, ok := sm.Err().(*InvariantError)
+	if !ok {
+		t.Fatalf("Expected the leaked reservation to stop the run, got %v", sm.Err())
+	}
+	if err.Time != 0 || len(err.Problems) == 0 || !strings.Contains(err.Problems[0], "upload reserved") {
+		t.Errorf("Expected the upload reservation to be reported after the first event, got %v", err)
+	}
+	if !strings.Contains(err.Dump, "node 9 ") {
+		t.Errorf("Expected the dump to list every node, got %s", err.Dump)
+	}
+	if sm.IsRunning() {
+		t.Error("Expected the run to be over")
+	}
+}
@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"encoding/json"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+type logger struct {
+	c chan<- []byte
+}
+
+// Message is a simulation event sent as JSON to the events channel of a Manager, Data depends on Code
+type Message struct {
+	Code int
+	Data interface{}
+}
+
+// NodeData is a node joining the swarm with the chunks it holds and the capacity of its host
+type NodeData struct {
+	Id            int
+	Host          int
+	File          int
+	Availability  [][][]segfile.Status // segment, redundancy level, chunk index
+	MaxDownloadBw float64
+	MaxUploadBw   float64
+}
+
+// NodeAvailabilityData is a change of the status of a chunk at a node
+type NodeAvailabilityData struct {
+	Id              int
+	Chunk           ChunkData
+	Status          segfile.Status
+	SegmentComplete bool
+}
+
+// ChunkData is a chunk by segment, chunk index and redundancy level, 0 for data chunks
+type ChunkData struct {
+	Seg int
+	Idx int
+	R   int
+}
+
+// TransferData is a transfer of a chunk between two nodes at the simulated Time it starts or ends
+type TransferData struct {
+	From      int
+	To        int
+	Chunk     ChunkData
+	Bandwidth float64
+	Time      float64
+}
+
+// RedundancyLevelData is the redundancy level the adaptive strategy chose for a
+// segment of a node, Peers is counted up to the MinPeers of the policy
+type RedundancyLevelData struct {
+	Id          int
+	Seg         int
+	Level       int
+	FailureRate float64
+	Peers       int
+	Throughput  float64
+}
+
+// SimulationStateData is the state a run has moved to
+type SimulationStateData struct {
+	State string
+}
+
+// NodeLeftData is a node leaving the swarm with the bytes it uploaded
+type NodeLeftData struct {
+	Id            int
+	Time          float64
+	UploadedBytes float64
+	Reason        string
+}
+
+// PlaybackData is a playback event, Duration is the startup latency or the stall length
+type PlaybackData struct {
+	Id       int
+	Event    string
+	Segment  int
+	Time     float64
+	Duration float64
+}
+
+// CapacityData is the capacity of a host following a bandwidth trace
+type CapacityData struct {
+	Host          int
+	Time          float64
+	MaxDownloadBw float64
+	MaxUploadBw   float64
+}
+
+// CommandResultData answers a command sent to the web interface, Error is set unless Ok
+type CommandResultData struct {
+	Command string
+	Ok      bool
+	Error   string
+}
+
+// Codes of the messages, by the type of their Data
+const (
+	MessageNodeAdded               int = iota // NodeData
+	MessageNodeAvailibilityUpdated            // NodeAvailabilityData
+	MessageSimulationState                    // SimulationStateData
+	MessageCommandResult                      // CommandResultData
+	MessageTransferStarted                    // TransferData
+	MessageTransferFinished                   // TransferData
+	MessageRedundancyLevelChosen              // RedundancyLevelData
+	MessageTransferCancelled                  // TransferData
+	MessageNodeLeft                           // NodeLeftData
+	MessagePlayback                           // PlaybackData
+	MessageCapacityChanged                    // CapacityData
+)
+
+const (
+	stateInitialized = "initialized"
+	stateRunning     = "running"
+	statePaused      = "paused"
+	stateStopped     = "stopped"
+	stateFinished    = "finished"
+	stateReset       = "reset"
+)
+
+const (
+	playbackStarted = "started"
+	playbackStalled = "stalled"
+)
+
+// send drops the message if the logger has no channel
+func (lg logger) send(code int, data interface{}) {
+	if lg.c == nil {
+		return
+	}
+	msg, err := json.Marshal(Message{code, data})
+	if err == nil {
+		lg.c <- msg
+	}
+}
+
+func (lg logger) logNodeAdded(n *Node) {
+	data := NodeData{n.id, n.host, n.file, n.sf.Availability(), n.MaxDownloadBw(), n.MaxUploadBw()}
+	lg.send(MessageNodeAdded, data)
+}
+
+func (lg logger) logNodeAvailabilityUpdated(id int, chk segfile.ChunkID, status segfile.Status, segmentComplete bool) {
+	data := NodeAvailabilityData{
+		id,
+		ChunkData{
+			chk.SIdx,
+			chk.CIdx,
+			chk.RIdx,
+		},
+		status,
+		segmentComplete,
+	}
+	lg.send(MessageNodeAvailibilityUpdated, data)
+}
+
+func (lg logger) logTransferStarted(n *Node, act Action, startTime float64) {
+	data := TransferData{act.Peer.id, n.id, ChunkData{act.Chunk.SIdx, act.Chunk.CIdx, act.Chunk.RIdx}, act.Bw, startTime}
+	lg.send(MessageTransferStarted, data)
+}
+
+func (lg logger) logTransferFinished(n *Node, act Action, finishTime float64) {
+	data := TransferData{act.Peer.id, n.id, ChunkData{act.Chunk.SIdx, act.Chunk.CIdx, act.Chunk.RIdx}, act.Bw, finishTime}
+	lg.send(MessageTransferFinished, data)
+}
+
+func (lg logger) logTransferCancelled(n *Node, act Action, cancelTime float64) {
+	data := TransferData{act.Peer.id, n.id, ChunkData{act.Chunk.SIdx, act.Chunk.CIdx, act.Chunk.RIdx}, act.Bw, cancelTime}
+	lg.send(MessageTransferCancelled, data)
+}
+
+func (lg logger) logRedundancyLevelChosen(id int, sIdx int, level int, failureRate float64, peers int, throughput float64) {
+	lg.send(MessageRedundancyLevelChosen, RedundancyLevelData{id, sIdx, level, failureRate, peers, throughput})
+}
+
+func (lg logger) logNodeLeft(id int, time float64, uploadedBytes float64, reason string) {
+	lg.send(MessageNodeLeft, NodeLeftData{id, time, uploadedBytes, reason})
+}
+
+func (lg logger) logPlayback(id int, event string, sIdx int, time float64, duration float64) {
+	lg.send(MessagePlayback, PlaybackData{id, event, sIdx, time, duration})
+}
+
+func (lg logger) logCapacityChanged(host int, time float64, down float64, up float64) {
+	lg.send(MessageCapacityChanged, CapacityData{host, time, down, up})
+}
+
+func (lg logger) logSimulationState(state string) {
+	lg.send(MessageSimulationState, SimulationStateData{state})
+}
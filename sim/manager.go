@@ -0,0 +1,317 @@
+// Package sim simulates swarms of nodes downloading segmented files with
+// redundancy from each other. A Manager runs a Scenario on a Supervisor, which
+// executes every transfer on a single-threaded event loop with a virtual
+// clock and asks the strategy registered under Scenario.Strategy which chunks
+// to request. The strategies live in package strategy.
+package sim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// Manager runs scenarios on a supervisor and controls the runs, its methods
+// are safe to call from any goroutine
+type Manager struct {
+	lock         sync.Mutex
+	running      bool
+	initialized  bool
+	supervisor   Supervisor
+	segfileInfos []*segfile.Info // one per file, nodes point into it
+	scenario     Scenario
+	started      bool // the supervisor holds a run, Start continues it
+	controller   *controller
+	cancel       context.CancelFunc
+	done         chan struct{}
+	err          error // why the last run stopped, nil if it finished or was stopped
+}
+
+// NewManager returns a manager without nodes. Simulation events are sent as
+// JSON messages on events, which must be drained, or dropped if it is nil.
+func NewManager(events chan<- []byte) *Manager {
+	sm := Manager{
+		running:     false,
+		initialized: false,
+		controller:  newController(),
+	}
+	sm.supervisor = Supervisor{
+		poolLock:    sync.RWMutex{},
+		pool:        make(map[*Node]struct{}),
+		hosts:       make(map[int]*Node),
+		bwRatioLock: sync.RWMutex{},
+		bwRatio:     make(map[*Node]float64),
+		lg:          logger{events},
+		mt:          newMetrics(),
+	}
+	sm.controller.onPark = sm.supervisor.mt.simulationParked
+	return &sm
+}
+
+// Supervisor returns the supervisor holding the swarms of the manager
+func (sm *Manager) Supervisor() *Supervisor {
+	return &sm.supervisor
+}
+
+// SetProgressLog writes the progress of every node of the next runs to w,
+// e.g. its transfers and completion, nil drops the messages. Must not be
+// called while a run is going on.
+func (sm *Manager) SetProgressLog(w io.Writer) {
+	sm.supervisor.progress = nil
+	if w != nil {
+		sm.supervisor.progress = log.New(w, "", 0)
+	}
+}
+
+// WriteMetrics writes the metrics of the simulation in the Prometheus text exposition format
+func (sm *Manager) WriteMetrics(w io.Writer) {
+	sm.supervisor.mt.writeTo(w)
+}
+
+// Initialize validates sc and creates its swarms
+func (sm *Manager) Initialize(sc Scenario) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.initialize(sc, nil)
+}
+
+// initialize creates the swarms of sc, part is the share of a worker of a
+// distributed run or nil. Must be called with lock held.
+func (sm *Manager) initialize(sc Scenario, part *partition) error {
+	if sm.initialized {
+		return errors.New("nodes already initialized")
+	}
+	if err := sc.validate(); err != nil {
+		return err
+	}
+	sm.scenario = sc
+	sm.started = false
+	files := sc.getFiles()
+	sm.segfileInfos = make([]*segfile.Info, len(files))
+	for f, spec := range files {
+		sfi, err := segfile.NewInfo(spec.FileSize, sc.SegmentSize, sc.ChunkSize, sc.Redundancy)
+		if err != nil {
+			return err
+		}
+		sm.segfileInfos[f] = sfi
+	}
+	sm.supervisor.configure(&sc)
+	sm.supervisor.part = part
+
+	capacities, err := newCapacitySampler(&sc)
+	if err != nil {
+		return err
+	}
+	var fileTrace []tracePoint
+	if sc.Traces.Share > 0 && sc.Traces.File != "" {
+		if fileTrace, err = loadTrace(sc.Traces.File); err != nil {
+			return err
+		}
+	}
+
+	// a host in several swarms has one node per file, all sharing its bandwidth
+	hosts := make([]*Node, sc.NumNodes)
+	offset := 0
+	var n *Node
+	for f, spec := range files {
+		for i := 0; i < sc.NumNodes; i++ {
+			h := (offset + i) % sc.NumNodes
+			var ratio float64
+			if ratio = sc.Availability; i < spec.NumSeeders {
+				ratio = 1
+			} else if spec.Interest < 1 && sm.supervisor.rng.Float64() >= spec.Interest {
+				continue
+			}
+			maxBw, downloadRatio := sc.MaxBandwidth, sc.DownloadRatio
+			if hosts[h] == nil {
+				maxBw, downloadRatio = capacities.sample(sm.supervisor.rng)
+			}
+			n = sm.supervisor.NewNode(sm.segfileInfos[f], maxBw, downloadRatio, ratio)
+			n.host, n.file = h, f
+			if hosts[h] != nil {
+				n.shareHost(hosts[h])
+			} else {
+				hosts[h] = n
+				if sc.Traces.Share > 0 && sm.supervisor.rng.Float64() < sc.Traces.Share {
+					trace := fileTrace
+					if trace == nil {
+						trace = sc.Traces.Markov.generate(n.MaxDownloadBw(), n.MaxUploadBw(), sm.supervisor.rng)
+					}
+					sm.supervisor.traces[h] = trace
+				}
+			}
+			sm.supervisor.AddNode(n)
+		}
+		offset += spec.NumSeeders
+	}
+	sm.initialized = true
+	log.Println("SIM: Nodes initialized...")
+	sm.supervisor.lg.logSimulationState(stateInitialized)
+	return nil
+}
+
+// Start launches every node and returns immediately, use Wait to block until
+// the run is over. A stopped or restored run continues where it was.
+func (sm *Manager) Start() error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if sm.running {
+		return errors.New("simulation already running")
+	}
+	if !sm.initialized {
+		return errors.New("simulation not initialized")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.cancel = cancel
+	sm.done = make(chan struct{})
+	sm.running = true
+	sm.err = nil
+	log.Println("SIM: Starting simulation...")
+	sm.supervisor.mt.simulationStarted()
+	sm.supervisor.lg.logSimulationState(stateRunning)
+
+	if !sm.started {
+		sm.supervisor.startRun()
+		sm.started = true
+	}
+	go sm.run(ctx, sm.done)
+	return nil
+}
+
+// run executes the events of the simulation, it owns the swarm until it returns
+func (sm *Manager) run(ctx context.Context, done chan struct{}) {
+	state := stateFinished
+	run := sm.supervisor.runEvents
+	if sm.supervisor.emulate {
+		run = sm.supervisor.runEmulation
+	}
+	err := run(ctx, sm.controller)
+	if err != nil {
+		state = stateStopped
+		if err != context.Canceled {
+			log.Println("SIM: ERROR", err)
+		}
+		log.Println("SIM: Simulation stopped!")
+	} else {
+		log.Println("SIM: Simulation done!")
+	}
+	sm.supervisor.mt.simulationStopped()
+
+	sm.lock.Lock()
+	if err != context.Canceled {
+		sm.err = err
+	}
+	sm.cancel()
+	sm.running = false
+	sm.cancel = nil
+	sm.lock.Unlock()
+
+	sm.supervisor.lg.logSimulationState(state)
+	close(done)
+}
+
+// Wait blocks until the current run has finished or been stopped
+func (sm *Manager) Wait() {
+	sm.lock.Lock()
+	done := sm.done
+	sm.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Err returns the error that stopped the last run, like an *InvariantError
+func (sm *Manager) Err() error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.err
+}
+
+// Stop cancels a running simulation, Wait returns once every node has quit
+func (sm *Manager) Stop() error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if !sm.running {
+		return errors.New("simulation not running")
+	}
+	sm.cancel()
+	log.Println("SIM: Stopping simulation...")
+	return nil
+}
+
+// Pause holds the run before its next event
+func (sm *Manager) Pause() error {
+	sm.controller.pause()
+	log.Println("SIM: Simulation paused")
+	sm.supervisor.lg.logSimulationState(statePaused)
+	return nil
+}
+
+// Resume lets a paused run continue
+func (sm *Manager) Resume() error {
+	sm.controller.resume()
+	log.Println("SIM: Simulation resumed")
+	if sm.IsRunning() {
+		sm.supervisor.lg.logSimulationState(stateRunning)
+	}
+	return nil
+}
+
+// Step advances a paused simulation by n events
+func (sm *Manager) Step(n int) error {
+	if n < 1 {
+		return errors.New("invalid number of steps")
+	}
+	sm.controller.step(n)
+	log.Println("SIM: Stepping", n, "events")
+	return nil
+}
+
+// PauseAt pauses the run before its first event due at or after simulated time t
+func (sm *Manager) PauseAt(t float64) {
+	sm.controller.setPauseAt(t)
+	log.Println("SIM: Pausing at", t)
+}
+
+// IsRunning reports whether a run was started and has not ended yet
+func (sm *Manager) IsRunning() bool {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.running
+}
+
+// Reset removes the swarms of a finished run so another scenario can be initialized
+func (sm *Manager) Reset() error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if sm.running {
+		return errors.New("simulation not finished yet")
+	}
+	if !sm.initialized {
+		return errors.New("nothing to reset")
+	}
+
+	pool := make(map[*Node]struct{})
+
+	// copy list of nodes to delete
+	for n := range sm.supervisor.pool {
+		pool[n] = struct{}{}
+	}
+
+	for n := range pool {
+		sm.supervisor.RemoveNode(n)
+	}
+
+	sm.supervisor.mt.reset()
+	sm.controller.resume()
+	sm.initialized = false
+	sm.started = false
+	log.Println("SIM: Supervisor reset!")
+	sm.supervisor.lg.logSimulationState(stateReset)
+	return nil
+}
@@ -0,0 +1,229 @@
+package sim
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// decision latency histogram buckets in seconds
+var decisionLatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+type metrics struct {
+	lock               sync.Mutex
+	nodes              int
+	completedNodes     int
+	departedNodes      int
+	activeTransfers    int
+	completedTransfers int
+	bytesTransferred   float64
+	cancelledTransfers int
+	redundantBytes     float64
+	playbacks          int
+	startupLatency     float64
+	stalls             int
+	stallTime          float64
+	decisionCount      int
+	decisionSum        float64
+	decisionBuckets    []int
+	simTime            float64
+	wallTime           float64   // wall clock seconds the run has been going, pauses excluded
+	since              time.Time // start of the wall time not counted yet, zero while not going
+	running            bool
+}
+
+func newMetrics() *metrics {
+	return &metrics{decisionBuckets: make([]int, len(decisionLatencyBuckets))}
+}
+
+func (mt *metrics) reset() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.nodes = 0
+	mt.completedNodes = 0
+	mt.departedNodes = 0
+	mt.activeTransfers = 0
+	mt.completedTransfers = 0
+	mt.bytesTransferred = 0
+	mt.cancelledTransfers = 0
+	mt.redundantBytes = 0
+	mt.playbacks = 0
+	mt.startupLatency = 0
+	mt.stalls = 0
+	mt.stallTime = 0
+	mt.decisionCount = 0
+	mt.decisionSum = 0
+	mt.decisionBuckets = make([]int, len(decisionLatencyBuckets))
+	mt.simTime = 0
+	mt.wallTime = 0
+	mt.since = time.Time{}
+	mt.running = false
+}
+
+func (mt *metrics) nodeAdded(complete bool) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.nodes++
+	if complete {
+		mt.completedNodes++
+	}
+}
+
+func (mt *metrics) nodeRemoved(complete bool) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.nodes--
+	if complete {
+		mt.completedNodes--
+	}
+}
+
+func (mt *metrics) nodeCompleted(simTime float64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.completedNodes++
+	mt.simTime = math.Max(mt.simTime, simTime)
+}
+
+func (mt *metrics) nodeDeparted() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.departedNodes++
+}
+
+func (mt *metrics) simulationStarted() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.since = time.Now()
+	mt.running = true
+}
+
+func (mt *metrics) simulationStopped() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.countWallTime()
+	mt.running = false
+}
+
+// simulationParked stops counting wall time while a paused run waits, and
+// starts again once it goes on
+func (mt *metrics) simulationParked(parked bool) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.countWallTime()
+	if !parked && mt.running {
+		mt.since = time.Now()
+	}
+}
+
+// countWallTime adds the wall time since the run last went on, must be called with lock held
+func (mt *metrics) countWallTime() {
+	if !mt.since.IsZero() {
+		mt.wallTime += time.Since(mt.since).Seconds()
+		mt.since = time.Time{}
+	}
+}
+
+func (mt *metrics) transferStarted() {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.activeTransfers++
+}
+
+func (mt *metrics) transferDone(bytes float64, simTime float64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.activeTransfers--
+	mt.completedTransfers++
+	mt.bytesTransferred += bytes
+	mt.simTime = math.Max(mt.simTime, simTime)
+}
+
+func (mt *metrics) transferCancelled(bytes float64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.activeTransfers--
+	mt.cancelledTransfers++
+	mt.bytesTransferred += bytes
+	mt.redundantBytes += bytes
+}
+
+func (mt *metrics) playbackStarted(latency float64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.playbacks++
+	mt.startupLatency += latency
+}
+
+func (mt *metrics) playbackStalled(duration float64) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	mt.stalls++
+	mt.stallTime += duration
+}
+
+func (mt *metrics) observeDecision(d time.Duration) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	sec := d.Seconds()
+	mt.decisionCount++
+	mt.decisionSum += sec
+	for i, le := range decisionLatencyBuckets {
+		if sec <= le {
+			mt.decisionBuckets[i]++
+		}
+	}
+}
+
+// writeTo writes all metrics in the Prometheus text exposition format
+func (mt *metrics) writeTo(w io.Writer) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+
+	wallTime := mt.wallTime
+	if !mt.since.IsZero() {
+		wallTime += time.Since(mt.since).Seconds()
+	}
+	var ratio float64
+	if wallTime > 0 {
+		ratio = mt.simTime / wallTime
+	}
+	running := 0
+	if mt.running {
+		running = 1
+	}
+
+	writeMetric(w, "dyrest_running", "gauge", "Whether a simulation is currently running.", float64(running))
+	writeMetric(w, "dyrest_nodes", "gauge", "Number of nodes in the swarm.", float64(mt.nodes))
+	writeMetric(w, "dyrest_completed_nodes", "gauge", "Number of nodes holding the complete file.", float64(mt.completedNodes))
+	writeMetric(w, "dyrest_departed_nodes", "gauge", "Number of nodes that left the swarm.", float64(mt.departedNodes))
+	writeMetric(w, "dyrest_active_transfers", "gauge", "Number of chunk transfers in progress.", float64(mt.activeTransfers))
+	writeMetric(w, "dyrest_transfers_total", "counter", "Number of completed chunk transfers.", float64(mt.completedTransfers))
+	writeMetric(w, "dyrest_transferred_bytes_total", "counter", "Number of bytes transferred between nodes.", mt.bytesTransferred)
+	writeMetric(w, "dyrest_cancelled_transfers_total", "counter", "Number of duplicate transfers cancelled in endgame mode.", float64(mt.cancelledTransfers))
+	writeMetric(w, "dyrest_redundant_bytes_total", "counter", "Number of bytes received by cancelled duplicate transfers.", mt.redundantBytes)
+	writeMetric(w, "dyrest_playbacks_started_total", "counter", "Number of nodes that started playback in streaming mode.", float64(mt.playbacks))
+	writeMetric(w, "dyrest_startup_latency_seconds_total", "counter", "Sum of the simulated startup latency of every playback.", mt.startupLatency)
+	writeMetric(w, "dyrest_playback_stalls_total", "counter", "Number of playback stalls waiting for a segment.", float64(mt.stalls))
+	writeMetric(w, "dyrest_playback_stall_seconds_total", "counter", "Simulated time playback spent stalled.", mt.stallTime)
+	writeMetric(w, "dyrest_simulated_time_seconds", "gauge", "Latest simulated time reached by any node.", mt.simTime)
+	writeMetric(w, "dyrest_wall_time_seconds", "gauge", "Wall clock time the simulation has been running, pauses excluded.", wallTime)
+	writeMetric(w, "dyrest_sim_wall_time_ratio", "gauge", "Simulated time divided by wall clock time.", ratio)
+
+	fmt.Fprintln(w, "# HELP dyrest_decision_latency_seconds Time taken by the supervisor to choose an action.")
+	fmt.Fprintln(w, "# TYPE dyrest_decision_latency_seconds histogram")
+	for i, le := range decisionLatencyBuckets {
+		fmt.Fprintf(w, "dyrest_decision_latency_seconds_bucket{le=\"%g\"} %d\n", le, mt.decisionBuckets[i])
+	}
+	fmt.Fprintf(w, "dyrest_decision_latency_seconds_bucket{le=\"+Inf\"} %d\n", mt.decisionCount)
+	fmt.Fprintf(w, "dyrest_decision_latency_seconds_sum %g\n", mt.decisionSum)
+	fmt.Fprintf(w, "dyrest_decision_latency_seconds_count %d\n", mt.decisionCount)
+}
+
+func writeMetric(w io.Writer, name string, typ string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
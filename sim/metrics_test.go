@@ -0,0 +1,92 @@
+package sim_test
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+// scrape returns the value of every metric of sm without labels
+func scrape(t *testing.T, sm *Manager) map[string]float64 {
+	var buf bytes.Buffer
+	sm.WriteMetrics(&buf)
+	values := make(map[string]float64)
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") || strings.Contains(fields[0], "{") {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values[fields[0]] = v
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 20
+	sc.NumSeeders = 2
+	sc.Seed = 6
+	sm := runScenario(t, sc)
+
+	m := scrape(t, sm)
+	if m["dyrest_running"] != 0 || m["dyrest_nodes"] != 20 || m["dyrest_completed_nodes"] != 20 || m["dyrest_active_transfers"] != 0 {
+		t.Errorf("Expected a finished run of 20 complete nodes, got %v", m)
+	}
+	if m["dyrest_transfers_total"] == 0 || m["dyrest_transferred_bytes_total"] < m["dyrest_transfers_total"]*float64(sc.ChunkSize) {
+		t.Errorf("Expected every transfer to carry a chunk, got %v transfers of %v bytes", m["dyrest_transfers_total"], m["dyrest_transferred_bytes_total"])
+	}
+	if m["dyrest_simulated_time_seconds"] != sm.Supervisor().Now() {
+		t.Errorf("Expected the simulated time to reach %v, got %v", sm.Supervisor().Now(), m["dyrest_simulated_time_seconds"])
+	}
+	if m["dyrest_decision_latency_seconds_count"] == 0 {
+		t.Error("Expected decisions to be observed")
+	}
+
+	// the wall time stops counting once the run is over
+	time.Sleep(20 * time.Millisecond)
+	if later := scrape(t, sm); later["dyrest_wall_time_seconds"] != m["dyrest_wall_time_seconds"] || m["dyrest_wall_time_seconds"] <= 0 {
+		t.Errorf("Expected the wall time to stay at %v after the run, got %v", m["dyrest_wall_time_seconds"], later["dyrest_wall_time_seconds"])
+	}
+}
+
+func TestMetricsPause(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 20
+	sc.Seed = 6
+	sc.Speed = 0
+	end := runScenario(t, sc).Supervisor().Now()
+
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	sm.PauseAt(end / 2)
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// a checkpoint waits for the run to be paused
+	if _, err := sm.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	const pause = 200 * time.Millisecond
+	time.Sleep(pause)
+	sm.Resume()
+	sm.Wait()
+	elapsed := time.Since(start)
+
+	wall := scrape(t, sm)["dyrest_wall_time_seconds"]
+	if wall <= 0 || wall > (elapsed-pause).Seconds() {
+		t.Errorf("Expected the wall time to leave out the %v pause of a %v run, got %v seconds", pause, elapsed, wall)
+	}
+}
@@ -0,0 +1,399 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+type bandwidth struct {
+	sync.RWMutex
+	value     float64
+	transfers int
+}
+
+func (bw *bandwidth) update(deltaBw float64) {
+	bw.Lock()
+	defer bw.Unlock()
+	bw.value += deltaBw
+}
+
+func (bw *bandwidth) get() float64 {
+	bw.RLock()
+	defer bw.RUnlock()
+	return bw.value
+}
+
+// reserve adds a transfer using deltaBw
+func (bw *bandwidth) reserve(deltaBw float64) {
+	bw.Lock()
+	defer bw.Unlock()
+	bw.value += deltaBw
+	bw.transfers++
+}
+
+// release removes a transfer using deltaBw
+func (bw *bandwidth) release(deltaBw float64) {
+	bw.Lock()
+	defer bw.Unlock()
+	bw.value -= deltaBw
+	bw.transfers--
+}
+
+func (bw *bandwidth) getTransfers() int {
+	bw.RLock()
+	defer bw.RUnlock()
+	return bw.transfers
+}
+
+// Node is a member of the swarm of one file, created by Supervisor.NewNode
+type Node struct {
+	id                int
+	host              int // nodes of the same host share its bandwidth
+	file              int
+	sf                segfile.Segfile
+	holders           *HolderIndex // holders of every chunk in the swarm of the file
+	currentDownloadBw *bandwidth
+	currentUploadBw   *bandwidth
+	link              *hostLink
+	connLock          sync.RWMutex
+	connectedNodes    map[*Node]int // transfers in flight per uploader
+	complete          bool
+	adaptive          AdaptiveState
+	transfers         map[segfile.ChunkID][]*transferHandle // transfers in flight per chunk
+	redundantBytes    float64
+	seeder            seederState
+	playback          playbackState
+}
+
+// transferHandle is a transfer in flight
+type transferHandle struct {
+	n         *Node // receiver
+	act       Action
+	startSim  float64
+	remaining float64 // bytes left at simulated time updated
+	updated   float64
+	rate      float64
+	finish    *event
+	want      float64 // rate chosen when the transfer started
+	downCap   float64 // download capacity of the receiver when the transfer started
+	upCap     float64 // upload capacity of the sender when the transfer started
+}
+
+// NewNode creates a node holding a random share availabilityRatio of the data
+// chunks of the file, with maxBandwidth of which bandwidthRatio is used for
+// downloading. The node takes part in the simulation once added with AddNode.
+func (sv *Supervisor) NewNode(sfi *segfile.Info, maxBandwidth float64, bandwidthRatio float64, availabilityRatio float64) *Node {
+	n := Node{
+		id:                sv.nodeIdx,
+		host:              sv.nodeIdx,
+		holders:           sv.holderIndex(sfi),
+		currentDownloadBw: &bandwidth{sync.RWMutex{}, 0, 0},
+		currentUploadBw:   &bandwidth{sync.RWMutex{}, 0, 0},
+		link:              newHostLink(maxBandwidth, bandwidthRatio),
+		connectedNodes:    make(map[*Node]int),
+		complete:          false,
+		transfers:         make(map[segfile.ChunkID][]*transferHandle),
+	}
+	n.sf.Init(sfi)
+	n.getRandomAvailability(availabilityRatio, sv.rng)
+	if availabilityRatio == 1 {
+		n.complete = true
+	}
+	n.seeder.init(n.complete)
+	sv.nodeIdx++
+	return &n
+}
+
+// shareHost makes n use the capacity and bandwidth accounting of h, so the
+// transfers of every swarm the host takes part in compete for it
+func (n *Node) shareHost(h *Node) {
+	n.host = h.host
+	n.link = h.link
+	n.currentDownloadBw = h.currentDownloadBw
+	n.currentUploadBw = h.currentUploadBw
+}
+
+// ID returns the id of n, unique within a run
+func (n *Node) ID() int {
+	return n.id
+}
+
+// Host returns the id of the host of n, nodes of the same host share its bandwidth
+func (n *Node) Host() int {
+	return n.host
+}
+
+// File returns the index of the file n downloads in the scenario
+func (n *Node) File() int {
+	return n.file
+}
+
+// Segfile returns the chunks held by n
+func (n *Node) Segfile() *segfile.Segfile {
+	return &n.sf
+}
+
+// Holders returns the holder index of the swarm of n
+func (n *Node) Holders() *HolderIndex {
+	return n.holders
+}
+
+// Complete reports whether n holds the whole file
+func (n *Node) Complete() bool {
+	return n.complete
+}
+
+// Adaptive returns the state of the adaptive strategy for n
+func (n *Node) Adaptive() *AdaptiveState {
+	return &n.adaptive
+}
+
+// SameFile reports whether n and p are in the swarm of the same file
+func (n *Node) SameFile(p *Node) bool {
+	return n.sf.Info == p.sf.Info
+}
+
+func (n *Node) getRandomAvailability(ratio float64, rng *rand.Rand) {
+	for _, idx := range rng.Perm(n.sf.NumDataChunks)[:int(ratio*float64(n.sf.NumDataChunks))] {
+		n.sf.SetChunk(n.sf.DataChunk(idx), segfile.Available)
+	}
+}
+
+// MaxDownloadBw returns the current download capacity of the host of n
+func (n *Node) MaxDownloadBw() float64 {
+	return n.link.getDown()
+}
+
+// MaxUploadBw returns the current upload capacity of the host of n
+func (n *Node) MaxUploadBw() float64 {
+	return n.link.getUp()
+}
+
+// FreeDownloadBw returns the download capacity of the host of n not reserved by transfers
+func (n *Node) FreeDownloadBw() float64 {
+	return n.MaxDownloadBw() - n.currentDownloadBw.get()
+}
+
+// FreeUploadBw returns the upload capacity of the host of n not reserved by transfers
+func (n *Node) FreeUploadBw() float64 {
+	return n.MaxUploadBw() - n.currentUploadBw.get()
+}
+
+// InFlight returns the number of transfers the host of n is currently downloading
+func (n *Node) InFlight() int {
+	return n.currentDownloadBw.getTransfers()
+}
+
+// Uploads returns the number of transfers the host of n is currently uploading
+func (n *Node) Uploads() int {
+	return n.currentUploadBw.getTransfers()
+}
+
+// Connections returns the number of transfers n is currently downloading from p
+func (n *Node) Connections(p *Node) int {
+	n.connLock.RLock()
+	defer n.connLock.RUnlock()
+	return n.connectedNodes[p]
+}
+
+// Departed reports whether n has left the swarm and accepts no new requests
+func (n *Node) Departed() bool {
+	return n.seeder.hasDeparted()
+}
+
+// SuperSeeding reports whether n only reveals one chunk at a time to each peer
+func (n *Node) SuperSeeding() bool {
+	return n.seeder.isSuperSeeding()
+}
+
+// UploadedBytes returns the number of bytes n has uploaded
+func (n *Node) UploadedBytes() float64 {
+	n.seeder.lock.Lock()
+	defer n.seeder.lock.Unlock()
+	return n.seeder.uploadedBytes
+}
+
+// CompletedAt returns the simulated time n completed its download, negative while it has not
+func (n *Node) CompletedAt() float64 {
+	n.seeder.lock.Lock()
+	defer n.seeder.lock.Unlock()
+	return n.seeder.seedSince
+}
+
+// decide runs whenever the situation of a downloading node changes: it
+// completes, starts new transfers or waits for the swarm to change
+func (n *Node) decide(sv *Supervisor) {
+	now := sv.Now()
+	if n.sf.PlannedComplete() {
+		if !n.sf.TransferInProgress() {
+			sv.Printf("%v : Download complete!, total time taken: %v, redundant bytes: %v\n", n.id, now, n.redundantBytes)
+			if sv.streaming.Enabled {
+				latency, stalls, stallTime := sv.getPlaybackSummary(n)
+				sv.Printf("%v : Playback startup latency %.2f, %v stalls, stalled for %.2f seconds\n", n.id, latency, stalls, stallTime)
+			}
+			n.complete = true
+			sv.sim.downloading--
+			sv.mt.nodeCompleted(now)
+			sv.seedingStarted(n, now)
+			return
+		}
+	} else {
+		sv.updateReveals(n)
+		decisionStart := time.Now()
+		acts := sv.planActions(n)
+		sv.mt.observeDecision(time.Since(decisionStart))
+		if len(acts) == 0 && !n.sf.TransferInProgress() {
+			// nothing to download until another node makes progress
+			sv.wait(n)
+			return
+		}
+		for _, act := range acts {
+			sv.Printf("%v <---(s: %v,c:%v,r:%v)---- %v : %.2f MB/s\n", n.id, act.Chunk.SIdx, act.Chunk.CIdx, act.Chunk.RIdx, act.Peer.id, act.Bw/MB)
+			sv.lg.logNodeAvailabilityUpdated(n.id, act.Chunk, segfile.PartiallyAvailable, false)
+			n.startTransfer(sv, act)
+		}
+	}
+
+	if sv.endgameThreshold > 0 && n.sf.TotalRemaining() <= sv.endgameThreshold {
+		for _, act := range sv.planEndgame(n) {
+			sv.Printf("%v <===(s: %v,c:%v,r:%v)==== %v : %.2f MB/s (endgame)\n", n.id, act.Chunk.SIdx, act.Chunk.CIdx, act.Chunk.RIdx, act.Peer.id, act.Bw/MB)
+			n.startTransfer(sv, act)
+		}
+	}
+}
+
+// finishTransfer runs when h has delivered its chunk
+func (n *Node) finishTransfer(sv *Supervisor, h *transferHandle) {
+	now := sv.Now()
+	sv.Printf("%v :Done!\n", n.id)
+	sv.removeInFlight(h)
+	n.transferDone(h.act)
+	sv.released(n, h.act)
+	sv.uploadFinished(h.act.Peer, n.sf.ChunkSize, now)
+	sv.updateReveals(n)
+	if sv.streaming.Enabled {
+		sv.updatePlayback(n, h.act.Chunk.SIdx, now)
+	}
+	n.adaptive.ObserveReceived(n.sf.ChunkSize, now, n.MaxDownloadBw(), sv.adaptive)
+	sv.mt.transferDone(n.sf.ChunkSize, now)
+	sv.lg.logTransferFinished(n, h.act, now)
+	sv.lg.logNodeAvailabilityUpdated(n.id, h.act.Chunk, segfile.Available, n.sf.IsSegmentComplete(h.act.Chunk.SIdx))
+
+	// the first copy of a chunk wins, the others are cancelled
+	for _, dup := range n.transfers[h.act.Chunk] {
+		if dup != h {
+			bytes := n.cancelTransfer(sv, dup)
+			sv.released(n, dup.act)
+			n.redundantBytes += bytes
+			sv.Printf("%v :Cancelled transfer from %v after %.0f bytes\n", n.id, dup.act.Peer.id, bytes)
+			sv.mt.transferCancelled(bytes)
+			sv.lg.logTransferCancelled(n, dup.act, now)
+		}
+	}
+	delete(n.transfers, h.act.Chunk)
+	sv.wakeIdle()
+	if sv.rounds {
+		// decide once every chunk of the round has arrived
+		sv.scheduleDecision(n)
+		return
+	}
+	n.decide(sv)
+}
+
+// PrepareTransfer marks the chunk of act in flight and reserves its bandwidth,
+// strategies choosing several actions at once call it between choices
+func (n *Node) PrepareTransfer(act Action) {
+	n.sf.SetChunk(act.Chunk, segfile.PartiallyAvailable)
+	n.connLock.Lock()
+	n.connectedNodes[act.Peer]++
+	n.connLock.Unlock()
+	n.currentDownloadBw.reserve(act.Bw)
+	act.Peer.currentUploadBw.reserve(act.Bw)
+}
+
+// prepareDuplicate reserves bandwidth for another copy of a chunk already in flight
+func (n *Node) prepareDuplicate(act Action) {
+	n.connLock.Lock()
+	n.connectedNodes[act.Peer]++
+	n.connLock.Unlock()
+	n.currentDownloadBw.reserve(act.Bw)
+	act.Peer.currentUploadBw.reserve(act.Bw)
+}
+
+// startTransfer schedules the end of a prepared action
+func (n *Node) startTransfer(sv *Supervisor, act Action) {
+	now := sv.Now()
+	h := &transferHandle{
+		n:         n,
+		act:       act,
+		startSim:  now,
+		remaining: n.sf.ChunkSize,
+		updated:   now,
+		rate:      act.Bw,
+		want:      act.Bw,
+		downCap:   n.MaxDownloadBw(),
+		upCap:     act.Peer.MaxUploadBw(),
+	}
+	n.transfers[act.Chunk] = append(n.transfers[act.Chunk], h)
+	sv.addInFlight(h)
+	sv.mt.transferStarted()
+	sv.lg.logTransferStarted(n, act, now)
+	if sv.rounds {
+		// the chunk arrives at the end of the round whatever the bandwidth
+		h.rate = n.sf.ChunkSize
+	} else if sv.Tracing() {
+		n.growTransfer(h)
+		h.rate = n.transferRate(h.act)
+	}
+	sv.Printf("%v :Transferring in %.2f seconds...\n", n.id, h.remaining/h.rate)
+	if sv.net != nil {
+		sv.emulateTransfer(h)
+		return
+	}
+	sv.scheduleFinish(h)
+	if sv.part != nil {
+		sv.part.arrivals = append(sv.part.arrivals, Arrival{n.id, act.Peer.id, act.Chunk, act.Bw, h.finish.t})
+	}
+}
+
+// scheduleFinish schedules the end of h at its current rate
+func (sv *Supervisor) scheduleFinish(h *transferHandle) {
+	h.finish = sv.schedule(h.updated+h.remaining/h.rate, false, func() { h.n.finishTransfer(sv, h) })
+	h.finish.kind, h.finish.n, h.finish.chunk = eventFinish, h.n, h.act.Chunk
+}
+
+// progress accounts for the bytes h received since it was last updated
+func (h *transferHandle) progress(now float64) {
+	h.remaining = math.Max(h.remaining-(now-h.updated)*h.rate, 0)
+	h.updated = now
+}
+
+// cancelTransfer aborts a transfer in flight and returns the bytes already received
+func (n *Node) cancelTransfer(sv *Supervisor, h *transferHandle) float64 {
+	h.progress(sv.Now())
+	sv.cancelEvent(h.finish)
+	sv.removeInFlight(h)
+	n.connLock.Lock()
+	if n.connectedNodes[h.act.Peer]--; n.connectedNodes[h.act.Peer] <= 0 {
+		delete(n.connectedNodes, h.act.Peer)
+	}
+	n.connLock.Unlock()
+	n.currentDownloadBw.release(h.act.Bw)
+	h.act.Peer.currentUploadBw.release(h.act.Bw)
+	return n.sf.ChunkSize - h.remaining
+}
+
+func (n *Node) transferDone(act Action) {
+	n.sf.SetChunk(act.Chunk, segfile.Available)
+	n.connLock.Lock()
+	if n.connectedNodes[act.Peer]--; n.connectedNodes[act.Peer] <= 0 {
+		delete(n.connectedNodes, act.Peer)
+	}
+	n.connLock.Unlock()
+	n.currentDownloadBw.release(act.Bw)
+	act.Peer.currentUploadBw.release(act.Bw)
+}
@@ -0,0 +1,205 @@
+package sim
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// partition is the share of the swarm a worker of a distributed run
+// simulates: the downloads of every host whose index is index modulo count,
+// so the download capacity of a host is only reserved by its worker. Every
+// worker holds the chunks and full upload capacity of the whole swarm, the
+// arrivals at the nodes of the other workers are delivered to it between two
+// windows with the upload bandwidth they hold until they arrive.
+type partition struct {
+	index    int
+	count    int
+	arrivals []Arrival                    // started since the last window
+	remote   map[*bandwidth]remoteUploads // upload reservations of the other workers
+}
+
+// remoteUploads is the upload bandwidth of a host reserved by transfers to the nodes of other workers
+type remoteUploads struct {
+	bw        float64
+	transfers int
+}
+
+// Arrival is chunk Chunk reaching node Node from node Peer at simulated time
+// T, over a transfer reserving Bw of the upload capacity of Peer
+type Arrival struct {
+	Node  int
+	Peer  int
+	Chunk segfile.ChunkID
+	Bw    float64
+	T     float64
+}
+
+// NodeResult is what a worker knows of a node at the end of a distributed run
+type NodeResult struct {
+	ID            int
+	Owned         bool    // the download of the node was simulated by the worker
+	Completed     float64 // simulated time the download completed, negative if it did not
+	UploadedBytes float64 // bytes uploaded to the nodes of the worker
+}
+
+// owns reports whether the downloads of n are simulated here
+func (sv *Supervisor) owns(n *Node) bool {
+	return sv.part == nil || n.host%sv.part.count == sv.part.index
+}
+
+// remoteUpload records delta more transfers to the nodes of other workers
+// reserving bw of up each, a negative delta records their end
+func (part *partition) remoteUpload(up *bandwidth, bw float64, delta int) {
+	r := part.remote[up]
+	r.bw += float64(delta) * bw
+	r.transfers += delta
+	if r.transfers == 0 {
+		delete(part.remote, up)
+		return
+	}
+	part.remote[up] = r
+}
+
+// validatePartition refuses what needs the whole swarm in one process:
+// capacities changing under transfers in flight, cancelled duplicates and
+// seeders leaving or hiding chunks depending on uploads to other workers.
+// Every worker builds the same swarm, so the seed must be set.
+func (sc *Scenario) validatePartition() error {
+	if sc.Seed == 0 {
+		return errors.New("distributed runs need a seed shared by every worker")
+	}
+	if sc.Traces.Share > 0 || sc.Rounds || sc.Emulate || sc.EndgameThreshold > 0 {
+		return errors.New("distributed runs do not support traces, rounds, emulation or endgame mode")
+	}
+	if sc.Seeding != (SeedingPolicy{}) {
+		return errors.New("distributed runs do not support seeding policies")
+	}
+	return nil
+}
+
+// InitializePart creates the swarms of sc for worker index of count workers.
+// The run is then driven window by window with Deliver and RunUntil.
+func (sm *Manager) InitializePart(sc Scenario, index int, count int) error {
+	if count < 1 || index < 0 || index >= count {
+		return errors.New("invalid worker index")
+	}
+	if err := sc.validatePartition(); err != nil {
+		return err
+	}
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	return sm.initialize(sc, &partition{index: index, count: count, remote: make(map[*bandwidth]remoteUploads)})
+}
+
+// Lookahead returns the shortest time any transfer of the run can take, an
+// arrival is always known that long before it happens
+func (sm *Manager) Lookahead() float64 {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	maxDown, chunkSize := 0.0, 0.0
+	for _, n := range sm.supervisor.Nodes() {
+		maxDown = math.Max(maxDown, n.MaxDownloadBw())
+		chunkSize = n.sf.ChunkSize
+	}
+	return chunkSize / maxDown
+}
+
+// startPart starts a worker run the first time it is driven, must be called with lock held
+func (sm *Manager) startPart() error {
+	if !sm.initialized || sm.supervisor.part == nil {
+		return errors.New("worker not initialized")
+	}
+	if !sm.started {
+		sm.supervisor.startRun()
+		sm.started = true
+	}
+	return nil
+}
+
+// Deliver schedules the arrivals at nodes of other workers. Their uploads are
+// reserved from now on, transfers started here within the last window could
+// not see them.
+func (sm *Manager) Deliver(arrivals []Arrival) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if err := sm.startPart(); err != nil {
+		return err
+	}
+	sv := &sm.supervisor
+	nodes := make(map[int]*Node)
+	for _, n := range sv.Nodes() {
+		nodes[n.id] = n
+	}
+	for _, a := range arrivals {
+		n, ok := nodes[a.Node]
+		p, peerOk := nodes[a.Peer]
+		if !ok || !peerOk || sv.owns(n) {
+			return errors.New("arrival at an unknown or local node")
+		}
+		chunk, bw := a.Chunk, a.Bw
+		p.currentUploadBw.reserve(bw)
+		sv.part.remoteUpload(p.currentUploadBw, bw, 1)
+		e := sv.schedule(a.T, true, func() {
+			n.sf.SetChunk(chunk, segfile.Available)
+			p.currentUploadBw.release(bw)
+			sv.part.remoteUpload(p.currentUploadBw, bw, -1)
+			// idle nodes may download from n or p now
+			sv.wakeIdle()
+		})
+		e.kind, e.n, e.chunk = eventArrival, n, chunk
+	}
+	return nil
+}
+
+// RunUntil runs the events due before end and returns the arrivals started
+// meanwhile with the time of the next event, infinite once nothing is left
+func (sm *Manager) RunUntil(end float64) ([]Arrival, float64, error) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	if err := sm.startPart(); err != nil {
+		return nil, 0, err
+	}
+	sv := &sm.supervisor
+	for {
+		for len(sv.sim.queue) > 0 && sv.sim.queue[0].cancelled {
+			heap.Pop(&sv.sim.queue)
+		}
+		if len(sv.sim.queue) == 0 || sv.sim.queue[0].t >= end {
+			break
+		}
+		e := heap.Pop(&sv.sim.queue).(*event)
+		if !e.background {
+			sv.sim.pending--
+		}
+		sv.sim.clock = e.t
+		e.run()
+		if err := sv.checkAfter(e.describe()); err != nil {
+			return nil, 0, err
+		}
+	}
+	arrivals := sv.part.arrivals
+	sv.part.arrivals = nil
+	next := math.Inf(1)
+	if len(sv.sim.queue) > 0 {
+		next = sv.sim.queue[0].t
+	}
+	return arrivals, next, nil
+}
+
+// PartResults returns the state of every node as seen by the worker
+func (sm *Manager) PartResults() []NodeResult {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+	var results []NodeResult
+	for _, n := range sm.supervisor.Nodes() {
+		r := NodeResult{n.id, sm.supervisor.owns(n), -1, n.UploadedBytes()}
+		if r.Owned {
+			r.Completed = n.CompletedAt()
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,61 @@
+package sim
+
+// MinTransferShare is the smallest share of its download capacity a node opens a transfer with
+const MinTransferShare = 0.01
+
+// planActions picks a batch of transfers for n across segments and peers.
+// Every action is reserved with PrepareTransfer before the next one is chosen,
+// so the batch never requests a chunk twice and respects the bandwidth, in-flight
+// and per-peer limits. In streaming mode segments are only fetched within the
+// lookahead and urgent segments take the fastest transfer available.
+func (sv *Supervisor) planActions(n *Node) []Action {
+	minBw := n.MaxDownloadBw() * MinTransferShare
+	var batch []Action
+
+	f, bf := getStrategy(sv.strategy)
+	if bf != nil {
+		for _, act := range bf(sv, n) {
+			if n.InFlight() >= sv.maxInFlight {
+				break
+			}
+			// bandwidth is only known once the earlier actions are reserved
+			if act.Bw = sv.Bandwidth(n, act.Peer); act.Bw < minBw {
+				continue
+			}
+			n.PrepareTransfer(act)
+			batch = append(batch, act)
+		}
+		return batch
+	}
+
+	if f == nil {
+		f, _ = getStrategy("dyrest")
+	}
+
+	streaming := sv.streaming.Enabled
+	for sIdx := 0; sIdx < n.sf.NumSegments; sIdx++ {
+		if streaming && !sv.InLookahead(n, sIdx) {
+			break
+		}
+		for {
+			if n.InFlight() >= sv.maxInFlight || n.MaxDownloadBw()-n.currentDownloadBw.get() < minBw {
+				return batch
+			}
+			if n.sf.IsSegmentComplete(sIdx) || n.sf.IsSegmentPlannedComplete(sIdx) {
+				break
+			}
+			var act Action
+			if streaming && sv.IsUrgent(n, sIdx) {
+				act = sv.getSegmentUrgentAction(n, sIdx)
+			} else {
+				act = f(sv, n, sIdx)
+			}
+			if act.Peer == nil || act.Bw < minBw {
+				break
+			}
+			n.PrepareTransfer(act)
+			batch = append(batch, act)
+		}
+	}
+	return batch
+}
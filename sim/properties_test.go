@@ -0,0 +1,149 @@
+package sim_test
+
+import (
+	"testing"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+type transferKey struct {
+	from, to int
+	chunk    ChunkData
+}
+
+type receivedKey struct {
+	to    int
+	chunk ChunkData
+}
+
+// checkEventLog replays the transfers of a run and checks that the bandwidth
+// reserved at every host stays within its capacity and that no node receives
+// a chunk twice or asks for a chunk it already holds
+func checkEventLog(t *testing.T, name string, log []event) {
+	hostOf := make(map[int]int)
+	downCap, upCap := make(map[int]float64), make(map[int]float64)
+	downUsed, upUsed := make(map[int]float64), make(map[int]float64)
+	active := make(map[transferKey][]float64)
+	received := make(map[receivedKey]bool)
+	const tolerance = 1e-6
+
+	for _, e := range log {
+		switch e.Code {
+		case MessageNodeAdded:
+			var d NodeData
+			decode(t, e, &d)
+			hostOf[d.Id] = d.Host
+			downCap[d.Host], upCap[d.Host] = d.MaxDownloadBw, d.MaxUploadBw
+		case MessageTransferStarted:
+			var d TransferData
+			decode(t, e, &d)
+			if received[receivedKey{d.To, d.Chunk}] {
+				t.Errorf("%s: Node %v requested chunk %+v it already holds at %v", name, d.To, d.Chunk, d.Time)
+			}
+			key := transferKey{d.From, d.To, d.Chunk}
+			active[key] = append(active[key], d.Bandwidth)
+			down, up := hostOf[d.To], hostOf[d.From]
+			downUsed[down] += d.Bandwidth
+			upUsed[up] += d.Bandwidth
+			if downUsed[down] > downCap[down]*(1+tolerance) {
+				t.Errorf("%s: Host %v downloads at %.0f over its capacity %.0f at %v", name, down, downUsed[down], downCap[down], d.Time)
+			}
+			if upUsed[up] > upCap[up]*(1+tolerance) {
+				t.Errorf("%s: Host %v uploads at %.0f over its capacity %.0f at %v", name, up, upUsed[up], upCap[up], d.Time)
+			}
+		case MessageTransferFinished, MessageTransferCancelled:
+			var d TransferData
+			decode(t, e, &d)
+			key := transferKey{d.From, d.To, d.Chunk}
+			if len(active[key]) == 0 {
+				t.Errorf("%s: Transfer %+v ended without starting", name, key)
+				continue
+			}
+			active[key] = active[key][1:]
+			downUsed[hostOf[d.To]] -= d.Bandwidth
+			upUsed[hostOf[d.From]] -= d.Bandwidth
+			if e.Code == MessageTransferFinished {
+				if received[receivedKey{d.To, d.Chunk}] {
+					t.Errorf("%s: Node %v received chunk %+v twice", name, d.To, d.Chunk)
+				}
+				received[receivedKey{d.To, d.Chunk}] = true
+			}
+		}
+	}
+	for key, bws := range active {
+		if len(bws) > 0 {
+			t.Errorf("%s: Transfer %+v never ended", name, key)
+		}
+	}
+}
+
+// propertyScenarios keep a seeder in the swarm and host capacities fixed
+var propertyScenarios = map[string]func(sc *Scenario){
+	"plain":    func(sc *Scenario) {},
+	"endgame":  func(sc *Scenario) { sc.EndgameThreshold = 5 },
+	"stream":   func(sc *Scenario) { sc.Streaming.Enabled = true; sc.Streaming.Lookahead = 3 },
+	"files":    func(sc *Scenario) { sc.Files = []FileSpec{{6 * MB, 1, 1}, {4 * MB, 1, 0.5}} },
+	"profiles": func(sc *Scenario) { sc.Contention = "fair"; sc.Profiles = []ProfileShare{{"cable", 1}, {"dsl", 1}} },
+	"greedy":   func(sc *Scenario) { sc.Contention = "greedy"; sc.MaxPerPeer = 3 },
+	"rounds":   func(sc *Scenario) { sc.Rounds = true },
+	"super":    func(sc *Scenario) { sc.Seeding.SuperSeeding = true },
+}
+
+func TestProperties(t *testing.T) {
+	seeds := 10
+	if testing.Short() {
+		seeds = 3
+	}
+	for name, setup := range propertyScenarios {
+		for _, strategy := range []string{"dyrest", "fast", "adaptive", "flow"} {
+			for seed := int64(1); seed <= int64(seeds); seed++ {
+				sc := DefaultScenario()
+				sc.NumNodes = 12
+				sc.NumSeeders = 1
+				sc.FileSize = 6 * MB
+				sc.Strategy = strategy
+				sc.Seed = seed
+				setup(&sc)
+				sm, log := recordScenario(t, sc)
+
+				run := name + "/" + strategy
+				checkEventLog(t, run, log)
+				for _, n := range sm.Supervisor().Nodes() {
+					if !n.Complete() || n.CompletedAt() < 0 {
+						t.Errorf("%s: Expected node %v to complete with seed %v", run, n.ID(), seed)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestLeaveTime(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 20
+	sc.NumSeeders = 2
+	sc.Seed = 4
+	sc.Seeding.LeaveTime = 1
+	sm, log := recordScenario(t, sc)
+
+	completed := make(map[int]float64)
+	for _, n := range sm.Supervisor().Nodes() {
+		completed[n.ID()] = n.CompletedAt()
+	}
+	left := 0
+	for _, e := range log {
+		if e.Code != MessageNodeLeft {
+			continue
+		}
+		var d NodeLeftData
+		decode(t, e, &d)
+		left++
+		// seeders leave on time whether they upload or not
+		if d.Time != completed[d.Id]+sc.Seeding.LeaveTime {
+			t.Errorf("Expected node %v completed at %v to leave at %v, left at %v", d.Id, completed[d.Id], completed[d.Id]+sc.Seeding.LeaveTime, d.Time)
+		}
+	}
+	if left < sc.NumSeeders {
+		t.Errorf("Expected at least the %v initial seeders to leave, %v left", sc.NumSeeders, left)
+	}
+}
@@ -0,0 +1,78 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+)
+
+func roundScenario() Scenario {
+	sc := DefaultScenario()
+	sc.NumNodes = 20
+	sc.NumSeeders = 2
+	sc.Seed = 5
+	sc.Speed = 0
+	sc.Rounds = true
+	return sc
+}
+
+func TestRoundsSingleLeecher(t *testing.T) {
+	sc := roundScenario()
+	sc.NumNodes, sc.Availability = 3, 0
+	sm := runScenario(t, sc)
+	checkQuiescent(t, "single leecher", sm)
+
+	// the leecher downloads one chunk per round
+	uploaded := 0.0
+	for _, n := range sm.Supervisor().Nodes() {
+		uploaded += n.UploadedBytes()
+	}
+	if chunks := uploaded / sc.ChunkSize; sm.Supervisor().Now() != chunks {
+		t.Errorf("Expected %v rounds, one per chunk, got %v", chunks, sm.Supervisor().Now())
+	}
+}
+
+func TestRoundsSwarm(t *testing.T) {
+	for _, strategy := range []string{"dyrest", "fast", "adaptive", "flow"} {
+		sc := roundScenario()
+		sc.Strategy = strategy
+
+		sm := NewManager(nil)
+		if err := sm.Initialize(sc); err != nil {
+			t.Fatal(err)
+		}
+		mostRemaining := 0
+		for _, n := range sm.Supervisor().Nodes() {
+			if remaining := n.Segfile().TotalRemaining(); remaining > mostRemaining {
+				mostRemaining = remaining
+			}
+		}
+		if err := sm.Start(); err != nil {
+			t.Fatal(err)
+		}
+		sm.Wait()
+		checkQuiescent(t, strategy, sm)
+
+		end := sm.Supervisor().Now()
+		if end != math.Floor(end) {
+			t.Errorf("%s: Expected the run to end on a round, got %v", strategy, end)
+		}
+		if end < float64(mostRemaining) {
+			t.Errorf("%s: Expected at least %v rounds for a node missing as many chunks, got %v", strategy, mostRemaining, end)
+		}
+	}
+}
+
+func TestRoundsValidation(t *testing.T) {
+	sc := roundScenario()
+	sc.Streaming.Enabled = true
+	if err := NewManager(nil).Initialize(sc); err == nil {
+		t.Error("Expected streaming to be refused in round mode")
+	}
+	sc = roundScenario()
+	sc.EndgameThreshold = 5
+	if err := NewManager(nil).Initialize(sc); err == nil {
+		t.Error("Expected endgame mode to be refused in round mode")
+	}
+}
@@ -0,0 +1,172 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// Sizes of files and chunks in bytes
+const (
+	KB = segfile.KB
+	MB = segfile.MB
+	GB = segfile.GB
+)
+
+// Scenario describes the swarm and file set up by Manager.Initialize.
+// Sizes are in bytes and bandwidths in bytes per second.
+type Scenario struct {
+	NumNodes      int
+	NumSeeders    int
+	Availability  float64 // ratio of chunks initially held by leechers
+	MaxBandwidth  float64
+	DownloadRatio float64        // share of MaxBandwidth used for downloading
+	Profiles      []ProfileShare // capacities drawn from named profiles instead of MaxBandwidth
+	BandwidthCDF  string         // file of an empirical capacity distribution, see loadBandwidthCDF
+	Contention    string         // contention model, see contentionModels
+	Traces        TraceConfig    // time-varying capacities of some hosts
+	FileSize      float64
+	SegmentSize   int // data chunks per segment
+	ChunkSize     float64
+	Redundancy    []segfile.RedundancyLevel
+	Strategy      string
+	Adaptive      AdaptivePolicy // used by the adaptive strategy
+	MaxInFlight   int            // transfers per downloading node
+	MaxPerPeer    int            // transfers per downloading node from a single uploader
+
+	EndgameThreshold  int             // remaining chunks that start endgame mode, 0 disables it
+	EndgameDuplicates int             // extra copies requested per chunk in endgame mode
+	Seeding           SeedingPolicy   // upload and leave rules of complete nodes
+	Streaming         StreamingPolicy // playback deadlines of the segments
+	Files             []FileSpec      // files shared in the swarm, empty for a single file of FileSize
+	Seed              int64           // 0 picks a time based seed
+	Speed             float64         // simulated seconds per wall clock second, 0 runs as fast as possible
+	Rounds            bool            // synchronous rounds: nodes download one chunk at a time, each taking a simulated second
+	Emulate           bool            // send the chunks over loopback TCP at the host capacities, in wall clock time
+	CheckInvariants   bool            // stop the run at the first event leaving its state inconsistent, slow
+}
+
+// FileSpec is one file of a scenario with several swarms. The seeders of a file
+// are taken from the hosts following the seeders of the previous file, every
+// other host joins its swarm with probability Interest.
+type FileSpec struct {
+	FileSize   float64
+	NumSeeders int
+	Interest   float64
+}
+
+// getFiles returns the files of the scenario, a single file every host wants when Files is empty
+func (sc *Scenario) getFiles() []FileSpec {
+	if len(sc.Files) == 0 {
+		return []FileSpec{{sc.FileSize, sc.NumSeeders, 1}}
+	}
+	return sc.Files
+}
+
+// DefaultScenario returns the scenario run by the command line tool
+func DefaultScenario() Scenario {
+	return Scenario{
+		NumNodes:      5,
+		NumSeeders:    1,
+		Availability:  0.5,
+		MaxBandwidth:  10 * MB,
+		DownloadRatio: 1 - 1/math.E,
+		Contention:    "crosstraffic",
+		Traces:        defaultTraceConfig(),
+		FileSize:      12 * MB,
+		SegmentSize:   10,
+		ChunkSize:     512 * KB,
+		Redundancy:    segfile.DefaultRedundancy(),
+		Strategy:      "dyrest",
+		Adaptive:      defaultAdaptivePolicy(),
+		MaxInFlight:   10,
+		MaxPerPeer:    1,
+
+		EndgameThreshold:  0,
+		EndgameDuplicates: 2,
+		Seeding:           SeedingPolicy{},
+		Streaming:         defaultStreamingPolicy(),
+		Seed:              0,
+		Speed:             1,
+		Rounds:            false,
+		Emulate:           false,
+		CheckInvariants:   false,
+	}
+}
+
+func (sc *Scenario) validate() error {
+	if sc.NumNodes < 1 {
+		return errors.New("number of nodes must be positive")
+	}
+	if sc.Availability < 0 || sc.Availability > 1 {
+		return errors.New("availability must be between 0 and 1")
+	}
+	if sc.MaxBandwidth <= 0 {
+		return errors.New("bandwidth must be positive")
+	}
+	if sc.DownloadRatio <= 0 || sc.DownloadRatio >= 1 {
+		return errors.New("download ratio must be between 0 and 1 exclusive")
+	}
+	if len(sc.Profiles) > 0 && sc.BandwidthCDF != "" {
+		return errors.New("choose either bandwidth profiles or a bandwidth distribution")
+	}
+	if err := validateProfiles(sc.Profiles); err != nil {
+		return err
+	}
+	if _, ok := contentionModels[sc.Contention]; !ok {
+		return fmt.Errorf("unknown contention model %q", sc.Contention)
+	}
+	if err := sc.Traces.validate(); err != nil {
+		return err
+	}
+	for _, f := range sc.getFiles() {
+		if f.FileSize <= 0 {
+			return errors.New("file size must be positive")
+		}
+		if sc.ChunkSize <= 0 || sc.ChunkSize > f.FileSize {
+			return errors.New("chunk size must be positive and no larger than the file")
+		}
+		if f.NumSeeders < 0 || f.NumSeeders > sc.NumNodes {
+			return fmt.Errorf("number of seeders must be between 0 and %d", sc.NumNodes)
+		}
+		if f.Interest < 0 || f.Interest > 1 {
+			return errors.New("interest must be between 0 and 1")
+		}
+	}
+	if sc.SegmentSize < 1 {
+		return errors.New("segment size must be positive")
+	}
+	if err := segfile.ValidateRedundancy(sc.Redundancy, sc.SegmentSize); err != nil {
+		return err
+	}
+	if err := sc.Adaptive.validate(len(sc.Redundancy)); err != nil {
+		return err
+	}
+	if sc.MaxInFlight < 1 || sc.MaxPerPeer < 1 {
+		return errors.New("in-flight limits must be positive")
+	}
+	if sc.EndgameThreshold < 0 || sc.EndgameDuplicates < 0 {
+		return errors.New("endgame settings must not be negative")
+	}
+	if err := sc.Seeding.validate(); err != nil {
+		return err
+	}
+	if err := sc.Streaming.validate(); err != nil {
+		return err
+	}
+	if sc.Speed < 0 {
+		return errors.New("speed must not be negative")
+	}
+	if sc.Rounds && (sc.Traces.Share > 0 || sc.Streaming.Enabled || sc.EndgameThreshold > 0) {
+		return errors.New("traces, streaming and endgame mode need continuous time")
+	}
+	if sc.Emulate && (sc.Rounds || sc.Traces.Share > 0 || sc.EndgameThreshold > 0) {
+		return errors.New("emulation does not support rounds, traces or endgame mode")
+	}
+	if !isStrategy(sc.Strategy) {
+		return fmt.Errorf("unknown strategy %q", sc.Strategy)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// SeedingPolicy configures how nodes holding the complete file behave
+type SeedingPolicy struct {
+	SuperSeeding      bool    // initial seeders reveal one unique chunk per peer until it is redistributed
+	LeaveRatio        float64 // seeders leave after uploading this many times the file size, 0 disables
+	LeaveTime         float64 // seeders leave this many simulated seconds after completing, 0 disables
+	LeaveOnCompletion bool    // leechers leave as soon as their own download completes
+}
+
+func (pol *SeedingPolicy) validate() error {
+	if pol.LeaveRatio < 0 || pol.LeaveTime < 0 {
+		return errors.New("seeder leave ratio and time must not be negative")
+	}
+	return nil
+}
+
+// seederState is shared by every node downloading from the owner
+type seederState struct {
+	lock          sync.Mutex
+	uploadedBytes float64
+	seedSince     float64 // simulated time the node completed, negative while leeching
+	departed      bool
+	superSeeding  bool
+	revealed      map[*Node]segfile.ChunkID // chunk currently offered to each peer when super-seeding
+}
+
+func (st *seederState) init(complete bool) {
+	st.seedSince = -1
+	if complete {
+		st.seedSince = 0
+	}
+	st.revealed = make(map[*Node]segfile.ChunkID)
+}
+
+func (st *seederState) hasDeparted() bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.departed
+}
+
+func (st *seederState) isSuperSeeding() bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.superSeeding
+}
+
+// uploadFinished credits p with an upload and lets it leave once its upload ratio is reached
+func (sv *Supervisor) uploadFinished(p *Node, bytes float64, now float64) {
+	p.seeder.lock.Lock()
+	p.seeder.uploadedBytes += bytes
+	p.seeder.lock.Unlock()
+	sv.checkRatio(p, now)
+}
+
+// seedingStarted is called when n completes its download at simulated time now
+func (sv *Supervisor) seedingStarted(n *Node, now float64) {
+	n.seeder.lock.Lock()
+	n.seeder.seedSince = now
+	n.seeder.lock.Unlock()
+	if sv.seeding.LeaveOnCompletion {
+		sv.depart(n, now, "download complete")
+		return
+	}
+	sv.checkRatio(n, now)
+	sv.scheduleDeparture(n, now+sv.seeding.LeaveTime)
+}
+
+// checkRatio lets seeder n leave once it has uploaded LeaveRatio times the file size
+func (sv *Supervisor) checkRatio(n *Node, now float64) {
+	if sv.seeding.LeaveRatio == 0 {
+		return
+	}
+	n.seeder.lock.Lock()
+	seeding := n.seeder.seedSince >= 0
+	ratio := n.seeder.uploadedBytes / n.sf.FileSize
+	n.seeder.lock.Unlock()
+	if seeding && ratio >= sv.seeding.LeaveRatio {
+		sv.depart(n, now, fmt.Sprintf("upload ratio %.2f reached", ratio))
+	}
+}
+
+// scheduleDeparture makes seeder n leave at simulated time t if the policy
+// limits the seeding time. The departure does not keep a run going.
+func (sv *Supervisor) scheduleDeparture(n *Node, t float64) {
+	if sv.seeding.LeaveTime == 0 {
+		return
+	}
+	e := sv.schedule(t, true, func() { sv.seedingOver(n) })
+	e.kind, e.n = eventDeparture, n
+}
+
+// seedingOver lets n leave once it has seeded for LeaveTime
+func (sv *Supervisor) seedingOver(n *Node) {
+	sv.depart(n, sv.Now(), fmt.Sprintf("seeded for %.2f seconds", sv.seeding.LeaveTime))
+}
+
+// depart stops n from accepting new requests, uploads in flight still finish
+func (sv *Supervisor) depart(n *Node, now float64, reason string) {
+	n.seeder.lock.Lock()
+	if n.seeder.departed {
+		n.seeder.lock.Unlock()
+		return
+	}
+	n.seeder.departed = true
+	uploaded := n.seeder.uploadedBytes
+	n.seeder.lock.Unlock()
+
+	sv.Printf("%v : Leaving the swarm at %.2f, %v\n", n.id, now, reason)
+	sv.mt.nodeDeparted()
+	sv.lg.logNodeLeft(n.id, now, uploaded, reason)
+}
+
+// VisibleStatus returns the status of chkId at p as seen by n. A super-seeder
+// only shows n the single chunk it currently reveals to it.
+func (sv *Supervisor) VisibleStatus(n *Node, p *Node, chkId segfile.ChunkID) segfile.Status {
+	status := p.sf.Status(chkId)
+	if status != segfile.Available || !p.seeder.isSuperSeeding() {
+		return status
+	}
+	if revealed, ok := sv.RevealedChunk(n, p); ok && revealed == chkId {
+		return status
+	}
+	return segfile.NotAvailable
+}
+
+// VisibleChunks is SegmentChunks of p as seen by n
+func (sv *Supervisor) VisibleChunks(n *Node, p *Node, sIdx int, rIdx int) []segfile.Status {
+	chunks := p.sf.SegmentChunks(sIdx, rIdx)
+	if !p.seeder.isSuperSeeding() {
+		return chunks
+	}
+	revealed, ok := sv.RevealedChunk(n, p)
+	for i := range chunks {
+		if !ok || revealed.SIdx != sIdx || revealed.RIdx != 0 || revealed.CIdx != i {
+			chunks[i] = segfile.NotAvailable
+		}
+	}
+	return chunks
+}
+
+// CanGenerate reports whether p would generate parity chunks of segment sIdx for n
+func (sv *Supervisor) CanGenerate(n *Node, p *Node, sIdx int) bool {
+	return p.sf.IsSegmentComplete(sIdx) && !p.seeder.isSuperSeeding()
+}
+
+// RevealedChunk returns the chunk super-seeder p currently offers n, none
+// before p has revealed one or once n holds it
+func (sv *Supervisor) RevealedChunk(n *Node, p *Node) (segfile.ChunkID, bool) {
+	p.seeder.lock.Lock()
+	defer p.seeder.lock.Unlock()
+	chk, ok := p.seeder.revealed[n]
+	return chk, ok && n.sf.Status(chk) != segfile.Available
+}
+
+// updateReveals lets the super-seeders of the swarm of n reveal it a new
+// chunk, it runs when n is about to start transfers and when one finishes
+func (sv *Supervisor) updateReveals(n *Node) {
+	if !sv.seeding.SuperSeeding || n.complete {
+		return
+	}
+	// the seeders are collected first, revealing reads the index again
+	var seeders []*Node
+	n.holders.EachComplete(0, func(p *Node, bound float64) bool {
+		if p != n && p.seeder.isSuperSeeding() {
+			seeders = append(seeders, p)
+		}
+		return true
+	})
+	for _, p := range seeders {
+		sv.revealChunk(n, p)
+	}
+}
+
+// revealChunk returns the chunk super-seeder p offers n. A new chunk, the one
+// n lacks that the fewest peers hold or have been offered, is only revealed
+// once the previous one has reached n and been seen at some other peer.
+func (sv *Supervisor) revealChunk(n *Node, p *Node) (segfile.ChunkID, bool) {
+	// the holders are counted before locking the seeder, readers of the index lock seeders
+	counts := n.holders.CountDataHolders()
+
+	p.seeder.lock.Lock()
+	defer p.seeder.lock.Unlock()
+
+	if prev, ok := p.seeder.revealed[n]; ok {
+		if n.sf.Status(prev) != segfile.Available {
+			return prev, true
+		}
+		// n and p hold it, any other holder means it has been redistributed
+		if counts[prev.SIdx][prev.CIdx] <= 2 {
+			return prev, false
+		}
+	}
+
+	offered := make(map[segfile.ChunkID]int)
+	for q, chk := range p.seeder.revealed {
+		if q != n {
+			offered[chk]++
+		}
+	}
+
+	var best segfile.ChunkID
+	bestHolders := -1
+	for sIdx := 0; sIdx < n.sf.NumSegments; sIdx++ {
+		for cIdx, status := range n.sf.SegmentChunks(sIdx, 0) {
+			if status != segfile.NotAvailable {
+				continue
+			}
+			chk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: cIdx}
+			holders := offered[chk] + counts[sIdx][cIdx]
+			if p.sf.Status(chk) == segfile.Available {
+				holders--
+			}
+			if bestHolders < 0 || holders < bestHolders {
+				best, bestHolders = chk, holders
+			}
+		}
+	}
+	if bestHolders < 0 {
+		return segfile.ChunkID{}, false
+	}
+	p.seeder.revealed[n] = best
+	return best, true
+}
@@ -0,0 +1,80 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+func TestRevealChunk(t *testing.T) {
+	sv := initializeTestSupervisor()
+	sv.seeding.SuperSeeding = true
+	segfileInfo, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	seeder := sv.NewNode(segfileInfo, 10*MB, 1-1/math.E, 1)
+	sv.AddNode(seeder)
+	a := sv.NewNode(segfileInfo, 10*MB, 1-1/math.E, 0)
+	sv.AddNode(a)
+	b := sv.NewNode(segfileInfo, 10*MB, 1-1/math.E, 0)
+	sv.AddNode(b)
+
+	// looking at the seeder reveals nothing
+	if _, ok := sv.RevealedChunk(a, seeder); ok || sv.VisibleChunks(a, seeder, 0, 0)[0] != segfile.NotAvailable || len(seeder.seeder.revealed) != 0 {
+		t.Fatal("Expected no chunk revealed before a transfer")
+	}
+	sv.updateReveals(a)
+	sv.updateReveals(b)
+	chkA, okA := sv.RevealedChunk(a, seeder)
+	chkB, okB := sv.RevealedChunk(b, seeder)
+	if !okA || !okB || chkA == chkB {
+		t.Fatalf("Expected distinct chunks for both peers, got %v %v", chkA, chkB)
+	}
+	if sv.CanGenerate(a, seeder, chkA.SIdx) {
+		t.Error("Expected a super-seeder not to generate parity chunks")
+	}
+	other := segfile.ChunkID{SIdx: chkB.SIdx, RIdx: 0, CIdx: chkB.CIdx}
+	if sv.VisibleStatus(a, seeder, other) != segfile.NotAvailable {
+		t.Error("Expected the chunk revealed to another peer to be hidden")
+	}
+
+	// a holds its chunk but nobody else does yet
+	a.sf.SetChunk(chkA, segfile.Available)
+	sv.updateReveals(a)
+	if _, ok := sv.RevealedChunk(a, seeder); ok {
+		t.Error("Expected no new chunk before the previous one is redistributed")
+	}
+	b.sf.SetChunk(chkA, segfile.Available)
+	if chk, ok := sv.RevealedChunk(a, seeder); ok {
+		t.Errorf("Expected the new chunk to wait for a transfer, got %v", chk)
+	}
+	sv.updateReveals(a)
+	if chk, ok := sv.RevealedChunk(a, seeder); !ok || chk == chkA {
+		t.Errorf("Expected a new chunk after redistribution, got %v", chk)
+	}
+}
+
+func TestSeederDeparture(t *testing.T) {
+	sv := initializeTestSupervisor()
+	sv.seeding.LeaveRatio = 0.5
+	initializeTestNodes(sv)
+
+	var seeder *Node
+	for p := range sv.pool {
+		if p.complete {
+			seeder = p
+		}
+	}
+	n := getUncompletedNode(sv)
+
+	sv.uploadFinished(seeder, seeder.sf.FileSize*0.25, 1)
+	if seeder.seeder.hasDeparted() || !sv.CanConnect(n, seeder) {
+		t.Fatal("Expected the seeder to stay below its upload ratio")
+	}
+	sv.uploadFinished(seeder, seeder.sf.FileSize*0.25, 2)
+	if !seeder.seeder.hasDeparted() || sv.CanConnect(n, seeder) {
+		t.Error("Expected the seeder to leave after reaching its upload ratio")
+	}
+	if n.seeder.hasDeparted() {
+		t.Error("Expected leechers to stay")
+	}
+}
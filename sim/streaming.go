@@ -0,0 +1,158 @@
+package sim
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// StreamingPolicy plays the file back while it downloads. Segment sIdx must be
+// complete when playback reaches it, otherwise playback stalls until it is.
+type StreamingPolicy struct {
+	Enabled      bool
+	Bitrate      float64 // playback rate in bytes per second
+	StartDelay   float64 // simulated seconds before playback starts
+	UrgentWindow float64 // segments due within this many seconds are urgent
+	Lookahead    int     // segments ahead of playback that may be fetched, 0 for all
+}
+
+func defaultStreamingPolicy() StreamingPolicy {
+	return StreamingPolicy{false, 2 * MB, 1, 1, 0}
+}
+
+func (pol *StreamingPolicy) validate() error {
+	if !pol.Enabled {
+		return nil
+	}
+	if pol.Bitrate <= 0 {
+		return errors.New("playback bitrate must be positive")
+	}
+	if pol.StartDelay < 0 || pol.UrgentWindow < 0 || pol.Lookahead < 0 {
+		return errors.New("streaming settings must not be negative")
+	}
+	return nil
+}
+
+// playbackState is the playback of a node, updated by its download loop and
+// read by the flow strategy of every node
+type playbackState struct {
+	lock        sync.Mutex
+	offsets     []float64 // playback position of every segment in seconds
+	completedAt []float64 // simulated time each segment completed, negative while missing
+	started     bool
+	startTime   float64
+	next        int // next segment to be played
+	stalls      int
+	stallTime   float64
+}
+
+// init must be called with the lock held
+func (st *playbackState) init(n *Node, pol StreamingPolicy) {
+	if st.offsets != nil {
+		return
+	}
+	st.offsets = make([]float64, n.sf.NumSegments)
+	st.completedAt = make([]float64, n.sf.NumSegments)
+	pos := 0.0
+	for sIdx := range st.offsets {
+		st.offsets[sIdx] = pos
+		pos += float64(n.sf.SegmentSize(sIdx)) * n.sf.ChunkSize / pol.Bitrate
+		st.completedAt[sIdx] = -1
+		if n.sf.IsSegmentComplete(sIdx) {
+			st.completedAt[sIdx] = 0
+		}
+	}
+}
+
+// segmentDeadline returns the simulated time playback of n reaches segment sIdx
+func (sv *Supervisor) segmentDeadline(n *Node, sIdx int) float64 {
+	st := &n.playback
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.init(n, sv.streaming)
+	if !st.started {
+		return math.Max(sv.streaming.StartDelay, sv.Now()) + st.offsets[sIdx]
+	}
+	return st.startTime + st.stallTime + st.offsets[sIdx]
+}
+
+// IsUrgent reports whether segment sIdx of n is due within the urgent window
+func (sv *Supervisor) IsUrgent(n *Node, sIdx int) bool {
+	return sv.segmentDeadline(n, sIdx)-sv.Now() <= sv.streaming.UrgentWindow
+}
+
+// InLookahead reports whether segment sIdx of n may be fetched yet
+func (sv *Supervisor) InLookahead(n *Node, sIdx int) bool {
+	if sv.streaming.Lookahead == 0 {
+		return true
+	}
+	st := &n.playback
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.init(n, sv.streaming)
+	return sIdx < st.next+sv.streaming.Lookahead
+}
+
+// updatePlayback records that segment sIdx of n may have completed at time t
+// and plays every segment that is ready, counting the stalls on the way
+func (sv *Supervisor) updatePlayback(n *Node, sIdx int, t float64) {
+	st := &n.playback
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.init(n, sv.streaming)
+	if st.completedAt[sIdx] < 0 && n.sf.IsSegmentComplete(sIdx) {
+		st.completedAt[sIdx] = t
+	}
+
+	for ; st.next < len(st.completedAt) && st.completedAt[st.next] >= 0; st.next++ {
+		ready := st.completedAt[st.next]
+		if !st.started {
+			st.started = true
+			st.startTime = math.Max(sv.streaming.StartDelay, ready)
+			sv.Printf("%v : Playback started at %.2f\n", n.id, st.startTime)
+			sv.mt.playbackStarted(st.startTime)
+			sv.lg.logPlayback(n.id, playbackStarted, 0, st.startTime, st.startTime)
+			continue
+		}
+		deadline := st.startTime + st.stallTime + st.offsets[st.next]
+		if ready > deadline {
+			st.stalls++
+			st.stallTime += ready - deadline
+			sv.Printf("%v : Playback stalled %.2f seconds before segment %v\n", n.id, ready-deadline, st.next)
+			sv.mt.playbackStalled(ready - deadline)
+			sv.lg.logPlayback(n.id, playbackStalled, st.next, deadline, ready-deadline)
+		}
+	}
+}
+
+// getPlaybackSummary returns the startup latency, number of stalls and time stalled of n
+func (sv *Supervisor) getPlaybackSummary(n *Node) (float64, int, float64) {
+	st := &n.playback
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	return st.startTime, st.stalls, st.stallTime
+}
+
+// getSegmentUrgentAction returns the fastest transfer towards completing
+// segment sIdx of n, ignoring the cost weights of the redundancy levels
+func (sv *Supervisor) getSegmentUrgentAction(n *Node, sIdx int) Action {
+	level := n.sf.BestLevel(sIdx)
+	size := n.sf.SegmentSize(sIdx)
+
+	var best Action
+	for acIdx, status := range n.sf.SegmentChunks(sIdx, level) {
+		if status != segfile.NotAvailable {
+			continue
+		}
+		chk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: acIdx}
+		if acIdx >= size {
+			chk = segfile.ChunkID{SIdx: sIdx, RIdx: level, CIdx: acIdx - size}
+		}
+		if p, bw := sv.fastestHolder(n, chk, best.Bw, nil); p != nil {
+			best = Action{p, chk, bw}
+		}
+	}
+	return best
+}
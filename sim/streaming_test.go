@@ -0,0 +1,47 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+func TestUpdatePlayback(t *testing.T) {
+	sv := initializeTestSupervisor()
+	sv.streaming = StreamingPolicy{true, 10 * 512 * KB, 0.5, 1, 0}
+	segfileInfo, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	n := sv.NewNode(segfileInfo, 10*MB, 1-1/math.E, 0)
+	sv.AddNode(n)
+
+	completeSegment := func(sIdx int, t float64) {
+		for cIdx := 0; cIdx < n.sf.SegmentSize(sIdx); cIdx++ {
+			n.sf.SetChunk(segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: cIdx}, segfile.Available)
+		}
+		sv.updatePlayback(n, sIdx, t)
+	}
+
+	if d := sv.segmentDeadline(n, 1); d != 1.5 {
+		t.Errorf("Expected segment 1 due at 1.5 before playback, got %v", d)
+	}
+	completeSegment(0, 0.2)
+	completeSegment(2, 0.4)
+	completeSegment(1, 2.0)
+
+	latency, stalls, stallTime := sv.getPlaybackSummary(n)
+	if latency != 0.5 {
+		t.Errorf("Expected playback to start after the start delay, got %v", latency)
+	}
+	if stalls != 1 || math.Abs(stallTime-0.5) > 1e-9 {
+		t.Errorf("Expected a single stall of 0.5 seconds, got %v stalls of %v seconds", stalls, stallTime)
+	}
+	if d := sv.segmentDeadline(n, 2); math.Abs(d-3) > 1e-9 {
+		t.Errorf("Expected segment 2 due at 3 after the stall, got %v", d)
+	}
+}
+
+func BenchmarkSegmentUrgentAction(b *testing.B) {
+	benchmarkDecision(b, func(sv *Supervisor, n *Node, i int) {
+		sv.getSegmentUrgentAction(n, i%n.sf.NumSegments)
+	})
+}
@@ -0,0 +1,169 @@
+package sim_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/minwhoo/dyrest-sim/sim"
+	_ "github.com/minwhoo/dyrest-sim/strategy"
+)
+
+// runScenario runs sc to its end as fast as possible
+func runScenario(t *testing.T, sc Scenario) *Manager {
+	sc.Speed = 0
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	return sm
+}
+
+// checkQuiescent checks that a finished run completed every node and left no
+// transfer or bandwidth reservation behind
+func checkQuiescent(t *testing.T, name string, sm *Manager) {
+	for _, problem := range Leftovers(sm) {
+		t.Errorf("%s: %s", name, problem)
+	}
+}
+
+var stressScenarios = map[string]func(sc *Scenario){
+	"plain":    func(sc *Scenario) {},
+	"traces":   func(sc *Scenario) { sc.Traces.Share = 0.5 },
+	"endgame":  func(sc *Scenario) { sc.EndgameThreshold = 5 },
+	"seeding":  func(sc *Scenario) { sc.Seeding = SeedingPolicy{true, 2, 0, false} },
+	"leave":    func(sc *Scenario) { sc.Seeding.LeaveTime = 5 },
+	"stream":   func(sc *Scenario) { sc.Streaming.Enabled = true; sc.Streaming.Lookahead = 3 },
+	"files":    func(sc *Scenario) { sc.Files = []FileSpec{{12 * MB, 1, 1}, {8 * MB, 2, 0.5}} },
+	"sparse":   func(sc *Scenario) { sc.Files = []FileSpec{{12 * MB, 1, 0.5}, {8 * MB, 1, 1}}; sc.Traces.Share = 0.5 },
+	"profiles": func(sc *Scenario) { sc.Contention = "fair"; sc.Profiles = []ProfileShare{{"cable", 1}, {"dsl", 1}} },
+	"rounds":   func(sc *Scenario) { sc.Rounds = true },
+}
+
+func TestStressScenarios(t *testing.T) {
+	numNodes := 100
+	if testing.Short() {
+		numNodes = 20
+	}
+	for name, mod := range stressScenarios {
+		for _, strategy := range []string{"dyrest", "fast", "adaptive", "flow"} {
+			if strategy == "flow" && !testing.Short() {
+				// the assignment is solved for the whole swarm on every decision
+				continue
+			}
+			sc := DefaultScenario()
+			sc.NumNodes = numNodes
+			sc.NumSeeders = 2
+			sc.Strategy = strategy
+			sc.Seed = 1
+			mod(&sc)
+			checkQuiescent(t, fmt.Sprintf("%s/%s", name, strategy), runScenario(t, sc))
+		}
+	}
+}
+
+func TestDeterministicRuns(t *testing.T) {
+	for _, name := range []string{"plain", "traces", "seeding", "files"} {
+		sc := DefaultScenario()
+		sc.NumNodes = 30
+		sc.Seed = 3
+		stressScenarios[name](&sc)
+
+		var uploaded []map[int]float64
+		var simTimes []float64
+		for run := 0; run < 2; run++ {
+			sm := runScenario(t, sc)
+			up := make(map[int]float64)
+			for _, n := range sm.Supervisor().Nodes() {
+				up[n.ID()] = n.UploadedBytes()
+			}
+			uploaded = append(uploaded, up)
+			simTimes = append(simTimes, sm.Supervisor().Now())
+		}
+		if simTimes[0] != simTimes[1] {
+			t.Errorf("%s: Expected runs with the same seed to end at the same time, got %v and %v", name, simTimes[0], simTimes[1])
+		}
+		for id, bytes := range uploaded[0] {
+			if uploaded[1][id] != bytes {
+				t.Errorf("%s: Expected node %v to upload %v bytes in both runs, got %v", name, id, bytes, uploaded[1][id])
+			}
+		}
+	}
+}
+
+// TestStressControl drives a paced run from several goroutines at once, the
+// way the web interface does, then stops it and runs the swarm again
+func TestStressControl(t *testing.T) {
+	sc := DefaultScenario()
+	sc.NumNodes = 50
+	sc.Seed = 5
+	sc.Speed = 100
+	sc.Traces.Share = 0.3
+
+	sm := NewManager(nil)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				switch i {
+				case 0:
+					sm.Pause()
+					sm.Step(5)
+					sm.Resume()
+				case 1:
+					sm.WriteMetrics(ioutil.Discard)
+				case 2:
+					sm.IsRunning()
+				case 3:
+					sm.IsPaused()
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := sm.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	close(done)
+	wg.Wait()
+
+	if sm.IsRunning() {
+		t.Fatal("Expected the run to be over after stop")
+	}
+	if err := sm.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	sc.Speed = 0
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	checkQuiescent(t, "rerun", sm)
+}
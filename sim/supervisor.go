@@ -0,0 +1,317 @@
+package sim
+
+import (
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+// Supervisor holds the swarms of a simulation and chooses the transfers of
+// their nodes with the strategy of the scenario
+type Supervisor struct {
+	poolLock    sync.RWMutex
+	pool        map[*Node]struct{}
+	hosts       map[int]*Node // a node of every host by index, the other nodes of the host share its link
+	bwRatioLock sync.RWMutex
+	bwRatio     map[*Node]float64 // share of upload capacity free of cross traffic
+	lg          logger
+	progress    *log.Logger // progress messages of every node, nil drops them
+	mt          *metrics
+	rng         *rand.Rand
+	src         *countingSource // source of rng, its state is saved by checkpoints
+	strategy    string
+	adaptive    AdaptivePolicy
+	maxInFlight int // transfers per downloading node
+	maxPerPeer  int // transfers per downloading node from a single uploader
+	contention  string
+	rounds      bool // every node transfers one chunk per round of a simulated second
+	emulate     bool // transfers go over the network of the run
+	checking    bool // invariants are checked after every event
+	net         *network
+	part        *partition // nodes simulated by this worker of a distributed run, nil simulates all
+
+	endgameThreshold  int // remaining chunks that start endgame mode, 0 disables it
+	endgameDuplicates int // extra copies requested per chunk in endgame mode
+
+	seeding   SeedingPolicy
+	streaming StreamingPolicy
+	sim       simulation
+	traces    map[int][]tracePoint // bandwidth trace per host index
+	nodeIdx   int                  // id of the next node
+	indexes   map[*segfile.Info]*HolderIndex
+	round     roundCache // what a batch strategy worked out for the decisions at one simulated time
+}
+
+// roundCache is a value a batch strategy shares between the decisions of a round
+type roundCache struct {
+	at    float64
+	value interface{}
+}
+
+// NewSupervisor returns a supervisor without nodes set up with the strategy,
+// limits and policies of sc. The scenario is not validated and its swarm is
+// not created, use a Manager to run whole scenarios.
+func NewSupervisor(sc Scenario) *Supervisor {
+	sv := Supervisor{
+		pool:    make(map[*Node]struct{}),
+		hosts:   make(map[int]*Node),
+		bwRatio: make(map[*Node]float64),
+		mt:      newMetrics(),
+	}
+	sv.configure(&sc)
+	return &sv
+}
+
+// configure applies the settings of sc and reseeds the random source
+func (sv *Supervisor) configure(sc *Scenario) {
+	seed := sc.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sv.src = newCountingSource(seed, 0)
+	sv.rng = rand.New(sv.src)
+	sv.strategy = sc.Strategy
+	sv.adaptive = sc.Adaptive
+	sv.maxInFlight = sc.MaxInFlight
+	if sc.Rounds {
+		sv.maxInFlight = 1
+	}
+	sv.maxPerPeer = sc.MaxPerPeer
+	sv.contention = sc.Contention
+	sv.rounds = sc.Rounds
+	sv.emulate = sc.Emulate
+	sv.checking = sc.CheckInvariants
+	sv.part = nil
+	sv.endgameThreshold = sc.EndgameThreshold
+	sv.endgameDuplicates = sc.EndgameDuplicates
+	sv.seeding = sc.Seeding
+	sv.streaming = sc.Streaming
+	sv.sim.speed = sc.Speed
+	sv.traces = make(map[int][]tracePoint)
+	sv.nodeIdx = 0
+	sv.indexes = make(map[*segfile.Info]*HolderIndex)
+	sv.round = roundCache{}
+}
+
+// countingSource counts the values drawn from a seeded source, so its state
+// can be saved as the seed and the number of draws
+type countingSource struct {
+	src   rand.Source64
+	seed  int64
+	draws uint64
+}
+
+// newCountingSource returns the source seeded with seed after draws values
+func newCountingSource(seed int64, draws uint64) *countingSource {
+	s := &countingSource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+	for s.draws < draws {
+		s.Uint64()
+	}
+	return s
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.src.Seed(seed)
+	s.seed, s.draws = seed, 0
+}
+
+// holderIndex returns the index of the swarm of the file sfi
+func (sv *Supervisor) holderIndex(sfi *segfile.Info) *HolderIndex {
+	hi, ok := sv.indexes[sfi]
+	if !ok {
+		hi = newHolderIndex(sfi)
+		sv.indexes[sfi] = hi
+	}
+	return hi
+}
+
+// RoundCache returns the value cached with SetRoundCache at the current
+// simulated time, nil once the run has moved on
+func (sv *Supervisor) RoundCache() interface{} {
+	if sv.round.at != sv.Now() {
+		return nil
+	}
+	return sv.round.value
+}
+
+// SetRoundCache keeps v for the other decisions at the current simulated time,
+// so a batch strategy works out a round once for every node
+func (sv *Supervisor) SetRoundCache(v interface{}) {
+	sv.round = roundCache{sv.Now(), v}
+}
+
+// SegmentStrategy returns the best transfer for segment sIdx of n, or an
+// action without peer when the segment cannot be served right now
+type SegmentStrategy func(sv *Supervisor, n *Node, sIdx int) Action
+
+// BatchStrategy chooses every transfer of a node at once instead of segment by
+// segment. The bandwidth of its actions is set when they are reserved.
+type BatchStrategy func(sv *Supervisor, n *Node) []Action
+
+var (
+	strategiesLock  sync.RWMutex
+	strategies      = make(map[string]SegmentStrategy)
+	batchStrategies = make(map[string]BatchStrategy)
+)
+
+// RegisterStrategy makes a segment strategy available as Scenario.Strategy name
+func RegisterStrategy(name string, f SegmentStrategy) {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	strategies[name] = f
+}
+
+// RegisterBatchStrategy makes a batch strategy available as Scenario.Strategy name
+func RegisterBatchStrategy(name string, f BatchStrategy) {
+	strategiesLock.Lock()
+	defer strategiesLock.Unlock()
+	batchStrategies[name] = f
+}
+
+// getStrategy returns the strategy registered as name, only one of the two is set
+func getStrategy(name string) (SegmentStrategy, BatchStrategy) {
+	strategiesLock.RLock()
+	defer strategiesLock.RUnlock()
+	return strategies[name], batchStrategies[name]
+}
+
+func isStrategy(name string) bool {
+	f, bf := getStrategy(name)
+	return f != nil || bf != nil
+}
+
+// Action is a transfer of Chunk from Peer at rate Bw
+type Action struct {
+	Peer  *Node
+	Chunk segfile.ChunkID
+	Bw    float64
+}
+
+// AddNode makes n a member of its swarm
+func (sv *Supervisor) AddNode(n *Node) {
+	sv.poolLock.Lock()
+	sv.pool[n] = struct{}{}
+	if _, ok := sv.hosts[n.host]; !ok {
+		sv.hosts[n.host] = n
+	}
+	sv.poolLock.Unlock()
+
+	sv.bwRatioLock.Lock()
+	//sv.bwRatio[n] = math.Min(math.Max(0.1, random.NormFloat64()*0.3+0.6), 0.9)
+	sv.bwRatio[n] = 0.1 + 0.9*sv.rng.Float64()
+	sv.bwRatioLock.Unlock()
+	n.holders.register(n, sv.rateBound(n))
+
+	if n.complete && sv.seeding.SuperSeeding {
+		n.seeder.lock.Lock()
+		n.seeder.superSeeding = true
+		n.seeder.lock.Unlock()
+	}
+	sv.mt.nodeAdded(n.complete)
+	sv.lg.logNodeAdded(n)
+}
+
+// RemoveNode takes n out of its swarm
+func (sv *Supervisor) RemoveNode(n *Node) {
+	sv.poolLock.Lock()
+	delete(sv.pool, n)
+	if sv.hosts[n.host] == n {
+		delete(sv.hosts, n.host)
+		// another node of the host stands for it
+		for p := range sv.pool {
+			if p.host == n.host {
+				sv.hosts[n.host] = p
+				break
+			}
+		}
+	}
+	sv.poolLock.Unlock()
+	n.holders.unregister(n)
+
+	sv.bwRatioLock.Lock()
+	delete(sv.bwRatio, n)
+	sv.bwRatioLock.Unlock()
+
+	sv.mt.nodeRemoved(n.complete)
+}
+
+// Printf writes a progress message if the supervisor has a progress log,
+// strategies report their choices with it
+func (sv *Supervisor) Printf(format string, args ...interface{}) {
+	if sv.progress != nil {
+		sv.progress.Printf(format, args...)
+	}
+}
+
+// sortedPool returns the pool ordered by node id, must be called with poolLock held
+func (sv *Supervisor) sortedPool() []*Node {
+	nodes := make([]*Node, 0, len(sv.pool))
+	for p := range sv.pool {
+		nodes = append(nodes, p)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes
+}
+
+// Nodes returns the nodes of every swarm ordered by id
+func (sv *Supervisor) Nodes() []*Node {
+	sv.poolLock.RLock()
+	defer sv.poolLock.RUnlock()
+	return sv.sortedPool()
+}
+
+// Rand returns the random source of the simulation, strategies draw from it so runs only depend on the seed
+func (sv *Supervisor) Rand() *rand.Rand {
+	return sv.rng
+}
+
+// MaxInFlight returns the number of transfers a host may download at once
+func (sv *Supervisor) MaxInFlight() int {
+	return sv.maxInFlight
+}
+
+// MaxPerPeer returns the number of transfers a node may download from a single uploader at once
+func (sv *Supervisor) MaxPerPeer() int {
+	return sv.maxPerPeer
+}
+
+// AdaptivePolicy returns the settings of the adaptive strategy
+func (sv *Supervisor) AdaptivePolicy() AdaptivePolicy {
+	return sv.adaptive
+}
+
+// Streaming returns the playback settings of streaming mode
+func (sv *Supervisor) Streaming() StreamingPolicy {
+	return sv.streaming
+}
+
+// CanConnect reports whether n may open another transfer from p
+func (sv *Supervisor) CanConnect(n *Node, p *Node) bool {
+	return n != p && n.SameFile(p) && !p.seeder.hasDeparted() && n.Connections(p) < sv.maxPerPeer
+}
+
+// Bandwidth returns the rate a new transfer from p to n would get under the contention model
+func (sv *Supervisor) Bandwidth(n *Node, p *Node) float64 {
+	model, ok := contentionModels[sv.contention]
+	if !ok {
+		model = crossTrafficContention
+	}
+	maxDownloadThroughput := n.MaxDownloadBw() - n.currentDownloadBw.get()
+	maxUploadThroughput := p.MaxUploadBw() - p.currentUploadBw.get()
+	return math.Max(model(sv, n, p, maxDownloadThroughput, maxUploadThroughput), 0)
+}
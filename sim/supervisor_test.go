@@ -0,0 +1,64 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+func initializeTestNodes(sv *Supervisor) {
+	segfileInfo, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	var n *Node
+	for i := 0; i < 10; i++ {
+		var ratio float64
+		if ratio = 0.4; i == 7 {
+			ratio = 1.0
+		}
+		n = sv.NewNode(segfileInfo, 10*MB, 1-1/math.E, ratio)
+		sv.AddNode(n)
+	}
+}
+
+func initializeTestSupervisor() *Supervisor {
+	return NewSupervisor(Scenario{Strategy: "dyrest", MaxInFlight: 10, MaxPerPeer: 1})
+}
+
+func getUncompletedNode(sv *Supervisor) *Node {
+	var n *Node
+	for p := range sv.pool {
+		if !p.complete {
+			n = p
+			break
+		}
+	}
+	return n
+}
+
+func TestSharedHost(t *testing.T) {
+	sv := initializeTestSupervisor()
+	first, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	second, _ := segfile.NewInfo(6*MB, 10, 512*KB, segfile.DefaultRedundancy())
+
+	seeder := sv.NewNode(first, 10*MB, 1-1/math.E, 1)
+	sv.AddNode(seeder)
+	// the seeder of the first file downloads the second one
+	leecher := sv.NewNode(second, 10*MB, 1-1/math.E, 0)
+	leecher.shareHost(seeder)
+	sv.AddNode(leecher)
+	other := sv.NewNode(second, 10*MB, 1-1/math.E, 1)
+	sv.AddNode(other)
+
+	if sv.CanConnect(leecher, seeder) {
+		t.Error("Expected no transfers between swarms of different files")
+	}
+	if !sv.CanConnect(leecher, other) {
+		t.Error("Expected transfers within the swarm of a file")
+	}
+
+	act := Action{other, segfile.ChunkID{SIdx: 0, RIdx: 0, CIdx: 0}, sv.Bandwidth(leecher, other)}
+	leecher.PrepareTransfer(act)
+	if seeder.InFlight() != 1 || seeder.currentDownloadBw.get() != act.Bw {
+		t.Error("Expected the host bandwidth to be shared across its swarms")
+	}
+}
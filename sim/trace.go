@@ -0,0 +1,242 @@
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hostLink is the access link of a host, shared by its nodes in every swarm
+type hostLink struct {
+	sync.RWMutex
+	maxBw float64
+	ratio float64 // share of maxBw used for downloading
+}
+
+func newHostLink(maxBw float64, ratio float64) *hostLink {
+	return &hostLink{maxBw: maxBw, ratio: ratio}
+}
+
+func (l *hostLink) getDown() float64 {
+	l.RLock()
+	defer l.RUnlock()
+	return l.maxBw * l.ratio
+}
+
+func (l *hostLink) getUp() float64 {
+	l.RLock()
+	defer l.RUnlock()
+	return l.maxBw * (1 - l.ratio)
+}
+
+func (l *hostLink) set(down float64, up float64) {
+	l.Lock()
+	defer l.Unlock()
+	l.maxBw = down + up
+	l.ratio = down / (down + up)
+}
+
+// tracePoint sets the capacity of a host from simulated time t on
+type tracePoint struct {
+	t    float64
+	down float64
+	up   float64
+}
+
+// MarkovTrace switches a host between on, at its full capacity, and off, at
+// OffFactor of it, staying in each state an exponentially distributed time
+type MarkovTrace struct {
+	MeanOn    float64 // mean simulated seconds in the on state
+	MeanOff   float64 // mean simulated seconds in the off state
+	OffFactor float64
+	Horizon   float64 // simulated seconds covered by the generated trace
+}
+
+// TraceConfig makes a share of the hosts follow a bandwidth trace, read from
+// File or generated by the Markov model when File is empty
+type TraceConfig struct {
+	Share  float64 // share of hosts following a trace, 0 disables traces
+	File   string  // see loadTrace
+	Markov MarkovTrace
+}
+
+func defaultTraceConfig() TraceConfig {
+	return TraceConfig{0, "", MarkovTrace{2, 1, 0.1, 600}}
+}
+
+func (tc *TraceConfig) validate() error {
+	if tc.Share < 0 || tc.Share > 1 {
+		return errors.New("trace share must be between 0 and 1")
+	}
+	if tc.Share == 0 || tc.File != "" {
+		return nil
+	}
+	m := tc.Markov
+	if m.MeanOn <= 0 || m.MeanOff <= 0 || m.Horizon <= 0 {
+		return errors.New("markov trace durations must be positive")
+	}
+	if m.OffFactor < 0 || m.OffFactor > 1 {
+		return errors.New("markov off factor must be between 0 and 1")
+	}
+	return nil
+}
+
+// loadTrace reads a bandwidth trace. Every line holds a simulated time in
+// seconds and the download and upload capacity in MB/s from then on, e.g.
+// "2.5,4,0.5", lines starting with # are ignored. Times must increase.
+func loadTrace(path string) ([]tracePoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var trace []tracePoint
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected time,down,up", path, line)
+		}
+		var values [3]float64
+		for i, field := range fields {
+			if values[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+			}
+		}
+		pt := tracePoint{values[0], values[1] * MB, values[2] * MB}
+		if pt.down <= 0 || pt.up <= 0 {
+			return nil, fmt.Errorf("%s:%d: capacities must be positive", path, line)
+		}
+		if n := len(trace); pt.t < 0 || (n > 0 && pt.t <= trace[n-1].t) {
+			return nil, fmt.Errorf("%s:%d: times must increase", path, line)
+		}
+		trace = append(trace, pt)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(trace) == 0 {
+		return nil, fmt.Errorf("%s: no trace rows", path)
+	}
+	return trace, nil
+}
+
+// generate returns an on/off trace for a host with the given capacity, starting in the on state
+func (m *MarkovTrace) generate(down float64, up float64, rng *rand.Rand) []tracePoint {
+	var trace []tracePoint
+	on := true
+	for t := 0.0; t < m.Horizon; {
+		if on {
+			trace = append(trace, tracePoint{t, down, up})
+			t += rng.ExpFloat64() * m.MeanOn
+		} else {
+			// capacities stay positive so transfers can still finish
+			off := math.Max(m.OffFactor, MinTransferShare)
+			trace = append(trace, tracePoint{t, down * off, up * off})
+			t += rng.ExpFloat64() * m.MeanOff
+		}
+		on = !on
+	}
+	return trace
+}
+
+// scheduleTrace applies the trace to the link of n as simulated time passes
+func (sv *Supervisor) scheduleTrace(n *Node, trace []tracePoint) {
+	for i, pt := range trace {
+		e := sv.schedule(pt.t, true, sv.applyTracePoint(n, pt))
+		e.kind, e.n, e.point = eventTrace, n, i
+	}
+}
+
+// applyTracePoint returns the event setting the capacity of the host of n to pt
+func (sv *Supervisor) applyTracePoint(n *Node, pt tracePoint) func() {
+	return func() {
+		sv.Printf("%v : Capacity changed at %.2f to down %.2f MB/s, up %.2f MB/s\n", n.host, pt.t, pt.down/MB, pt.up/MB)
+		n.link.set(pt.down, pt.up)
+		sv.lg.logCapacityChanged(n.host, pt.t, pt.down, pt.up)
+		sv.linksChanged(n.link)
+		// idle nodes may be able to start transfers now
+		sv.wakeIdle()
+	}
+}
+
+// Tracing reports whether some host follows a bandwidth trace, capacities then change during the run
+func (sv *Supervisor) Tracing() bool {
+	return len(sv.traces) > 0
+}
+
+// traceHosts returns the indexes of the hosts following a trace in order
+func (sv *Supervisor) traceHosts() []int {
+	var hosts []int
+	for h := range sv.traces {
+		hosts = append(hosts, h)
+	}
+	sort.Ints(hosts)
+	return hosts
+}
+
+// released updates the transfers sharing the links of a finished transfer,
+// they may have been throttled below their reserved rate
+func (sv *Supervisor) released(n *Node, act Action) {
+	if sv.Tracing() {
+		sv.linksChanged(n.link, act.Peer.link)
+	}
+}
+
+// linksChanged recomputes the rate of every transfer in flight over one of the links
+func (sv *Supervisor) linksChanged(links ...*hostLink) {
+	now := sv.Now()
+	for _, h := range append([]*transferHandle(nil), sv.sim.inFlight...) {
+		for _, l := range links {
+			if h.n.link != l && h.act.Peer.link != l {
+				continue
+			}
+			h.progress(now)
+			h.n.growTransfer(h)
+			h.rate = h.n.transferRate(h.act)
+			sv.cancelEvent(h.finish)
+			sv.scheduleFinish(h)
+			break
+		}
+	}
+}
+
+// growTransfer raises the reservation of h, with the capacity left on both
+// links, towards the rate it started with scaled by how much the capacity of
+// either end grew since, so transfers started while a link was congested speed
+// up again. Runs on the event loop, which owns h.
+func (n *Node) growTransfer(h *transferHandle) {
+	p := h.act.Peer
+	target := h.want * math.Min(n.MaxDownloadBw()/h.downCap, p.MaxUploadBw()/h.upCap)
+	extra := math.Min(n.MaxDownloadBw()-n.currentDownloadBw.get(), p.MaxUploadBw()-p.currentUploadBw.get())
+	if extra = math.Min(extra, target-h.act.Bw); extra > 0 {
+		n.currentDownloadBw.update(extra)
+		p.currentUploadBw.update(extra)
+		h.act.Bw += extra
+	}
+}
+
+// transferRate returns the rate of a transfer reserved at act.Bw, scaled down
+// while a host has less capacity than it has reserved
+func (n *Node) transferRate(act Action) float64 {
+	scale := 1.0
+	if reserved, capacity := n.currentDownloadBw.get(), n.MaxDownloadBw(); reserved > capacity {
+		scale = capacity / reserved
+	}
+	if reserved, capacity := act.Peer.currentUploadBw.get(), act.Peer.MaxUploadBw(); reserved > capacity {
+		scale = math.Min(scale, capacity/reserved)
+	}
+	return act.Bw * scale
+}
@@ -0,0 +1,51 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+)
+
+func TestMarkovTrace(t *testing.T) {
+	m := MarkovTrace{2, 1, 0.1, 100}
+	trace := m.generate(8*MB, 2*MB, rand.New(rand.NewSource(1)))
+	if len(trace) < 2 || trace[0].t != 0 || trace[0].down != 8*MB {
+		t.Fatal("Expected the trace to start in the on state")
+	}
+	for i := 1; i < len(trace); i++ {
+		if trace[i].t <= trace[i-1].t || trace[i].t >= m.Horizon {
+			t.Fatalf("Unexpected time %v after %v", trace[i].t, trace[i-1].t)
+		}
+		if on := i%2 == 0; on != (trace[i].up == 2*MB) {
+			t.Fatalf("Expected the states to alternate, got %v at %v", trace[i].up/MB, i)
+		}
+	}
+}
+
+func TestTransferRate(t *testing.T) {
+	sv := initializeTestSupervisor()
+	segfileInfo, _ := segfile.NewInfo(12*MB, 10, 512*KB, segfile.DefaultRedundancy())
+	p := sv.NewNode(segfileInfo, 8*MB, 0.5, 1)
+	sv.AddNode(p)
+	n := sv.NewNode(segfileInfo, 8*MB, 0.5, 0)
+	sv.AddNode(n)
+
+	act := Action{p, segfile.ChunkID{SIdx: 0, RIdx: 0, CIdx: 0}, 4 * MB}
+	n.PrepareTransfer(act)
+	h := &transferHandle{act: act, want: act.Bw, downCap: n.MaxDownloadBw(), upCap: p.MaxUploadBw()}
+
+	// the uploader drops to a quarter of its capacity
+	p.link.set(1*MB, 1*MB)
+	if rate := n.transferRate(h.act); math.Abs(rate-1*MB) > 1e-6 {
+		t.Errorf("Expected the transfer to be throttled to 1 MB/s, got %v", rate/MB)
+	}
+
+	// once capacity returns the transfer grows back to its original rate
+	p.link.set(4*MB, 4*MB)
+	n.growTransfer(h)
+	if h.act.Bw != 4*MB || n.transferRate(h.act) != 4*MB {
+		t.Errorf("Expected the transfer back at 4 MB/s, got %v", h.act.Bw/MB)
+	}
+}
@@ -0,0 +1,108 @@
+package strategy
+
+import (
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// countUsefulPeers returns the number of peers holding a data chunk of
+// segment sIdx that n lacks, counting up to limit. The holders are searched
+// fastest first and the search stops once limit peers are found.
+func countUsefulPeers(sv *sim.Supervisor, n *sim.Node, sIdx int, limit int) int {
+	nChunks := n.Segfile().SegmentChunks(sIdx, 0)
+	useful := make(map[*sim.Node]struct{})
+	superSeeders := make(map[*sim.Node]struct{})
+	for cIdx, status := range nChunks {
+		if status != segfile.NotAvailable {
+			continue
+		}
+		if len(useful) >= limit {
+			return len(useful)
+		}
+		n.Holders().EachHolder(segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: cIdx}, func(p *sim.Node, bound float64) bool {
+			if p.Departed() {
+				return true
+			}
+			if p.SuperSeeding() {
+				superSeeders[p] = struct{}{}
+			} else {
+				useful[p] = struct{}{}
+			}
+			return len(useful) < limit
+		})
+	}
+	// a super-seeder is only useful if the chunk it reveals to n is in the segment
+	for p := range superSeeders {
+		if len(useful) >= limit {
+			break
+		}
+		if chk, ok := sv.RevealedChunk(n, p); ok && chk.SIdx == sIdx && nChunks[chk.CIdx] == segfile.NotAvailable {
+			useful[p] = struct{}{}
+		}
+	}
+	return len(useful)
+}
+
+// chooseLevel picks the redundancy level n targets for segment sIdx from the
+// failure rate, useful peer count and throughput observed so far. Only the
+// peers needed to reach MinPeers are counted.
+func chooseLevel(sv *sim.Supervisor, n *sim.Node, sIdx int) int {
+	pol := sv.AdaptivePolicy()
+	st := n.Adaptive()
+	peers := countUsefulPeers(sv, n, sIdx, pol.MinPeers)
+	numLevels := n.Segfile().NumLevels()
+
+	level := st.Level
+	if st.FailureRate > pol.RaiseFailureRate || peers < pol.MinPeers || st.Throughput < pol.LowThroughput {
+		level++
+	} else if st.FailureRate < pol.LowerFailureRate {
+		level--
+	}
+	if level > numLevels {
+		level = numLevels
+	}
+	if level < 0 {
+		level = 0
+	}
+
+	prev, chosen := st.Levels[sIdx]
+	st.Level = level
+	st.Levels[sIdx] = level
+	if chosen && prev == level {
+		return level
+	}
+	sv.LevelChosen(n, sIdx, level, peers)
+	return level
+}
+
+// getSegmentAdaptiveAction works like getSegmentOptimalAction but only
+// considers the redundancy level chosen for the segment by the adaptive policy
+func getSegmentAdaptiveAction(sv *sim.Supervisor, n *sim.Node, sIdx int) sim.Action {
+	pol := sv.AdaptivePolicy()
+	st := n.Adaptive()
+	st.Init(pol)
+
+	level, ok := st.Levels[sIdx]
+	if !ok {
+		level = chooseLevel(sv, n, sIdx)
+	}
+
+	_, _, broken, p, c := getCost(sv, n, sIdx, level)
+	st.ObserveDecision(p == nil || broken, pol.Smoothing)
+	if p == nil {
+		// the level cannot make progress, choose again with the failure recorded
+		level = chooseLevel(sv, n, sIdx)
+		_, _, _, p, c = getCost(sv, n, sIdx, level)
+	}
+	if p == nil {
+		return noAction()
+	}
+
+	size := n.Segfile().SegmentSize(sIdx)
+	chk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: c}
+	if c >= size {
+		chk = segfile.ChunkID{SIdx: sIdx, RIdx: level, CIdx: c - size}
+	}
+	bw := sv.Bandwidth(n, p)
+	return sim.Action{Peer: p, Chunk: chk, Bw: bw}
+}
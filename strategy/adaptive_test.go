@@ -0,0 +1,62 @@
+package strategy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// TestAdaptiveHealthySwarm runs a swarm whose peers never fail, its nodes
+// must not raise their redundancy level
+func TestAdaptiveHealthySwarm(t *testing.T) {
+	sc := sim.DefaultScenario()
+	sc.NumNodes = 30
+	sc.NumSeeders = 2
+	sc.FileSize = 60 * sim.MB
+	sc.Seed = 1
+	sc.Speed = 0
+	sc.Strategy = "adaptive"
+
+	events := make(chan []byte)
+	var levels []sim.RedundancyLevelData
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for msg := range events {
+			var m struct {
+				Code int
+				Data json.RawMessage
+			}
+			if err := json.Unmarshal(msg, &m); err != nil {
+				t.Error(err)
+			}
+			if m.Code == sim.MessageRedundancyLevelChosen {
+				var d sim.RedundancyLevelData
+				if err := json.Unmarshal(m.Data, &d); err != nil {
+					t.Error(err)
+				}
+				levels = append(levels, d)
+			}
+		}
+	}()
+	sm := sim.NewManager(events)
+	if err := sm.Initialize(sc); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sm.Wait()
+	close(events)
+	<-done
+
+	if len(levels) == 0 {
+		t.Fatal("Expected the nodes to choose redundancy levels")
+	}
+	for _, d := range levels {
+		if d.Level != 0 {
+			t.Errorf("Expected node %v to stay at level 0 for segment %v, got %+v", d.Id, d.Seg, d)
+		}
+	}
+}
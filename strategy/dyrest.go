@@ -0,0 +1,180 @@
+package strategy
+
+import (
+	"math"
+	"sort"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+func getOptimalAction(sv *sim.Supervisor, n *sim.Node) sim.Action {
+	sf := n.Segfile()
+	for sIdx := 0; sIdx < sf.NumSegments; sIdx++ {
+		if !sf.IsSegmentComplete(sIdx) && !sf.IsSegmentPlannedComplete(sIdx) {
+			if act := getSegmentOptimalAction(sv, n, sIdx); act.Peer != nil {
+				return act
+			}
+		}
+	}
+	return noAction()
+}
+
+func getSegmentOptimalAction(sv *sim.Supervisor, n *sim.Node, sIdx int) sim.Action {
+	sf := n.Segfile()
+
+	// without redundancy levels only the data chunks can be used
+	minLevel := 1
+	if sf.NumLevels() == 0 {
+		minLevel = 0
+	}
+
+	var minP *sim.Node
+	var minCIdx int
+	var minRIdx int
+	var bw float64
+	minCost := math.Inf(1)
+
+	for r := minLevel; r <= sf.NumLevels(); r++ {
+		_, b, _, p, c := getCost(sv, n, sIdx, r)
+		if b < minCost && p != nil {
+			minP = p
+			if c < sf.SegmentSize(sIdx) {
+				minCIdx = c
+				minRIdx = 0
+			} else {
+				minCIdx = c - sf.SegmentSize(sIdx)
+				minRIdx = r
+			}
+			minCost = b
+		}
+	}
+
+	if minP != nil {
+		bw = sv.Bandwidth(n, minP)
+	} else {
+		bw = 0
+	}
+	return sim.Action{Peer: minP, Chunk: segfile.ChunkID{SIdx: sIdx, RIdx: minRIdx, CIdx: minCIdx}, Bw: bw}
+}
+
+// getCost estimates the cost of completing segment sIdx of n using data chunks
+// and the chunks of redundancy level rIdx. Only the holders of the chunks n
+// lacks are considered, found through the holder index.
+func getCost(sv *sim.Supervisor, n *sim.Node, sIdx int, rIdx int) (float64, float64, bool, *sim.Node, int) {
+	// bounds only hold while capacities are fixed
+	return segmentCost(sv, n, sIdx, rIdx, !sv.Tracing())
+}
+
+// segmentCost is getCost, stopping at the rate bounds of the holders if pruning is set
+func segmentCost(sv *sim.Supervisor, n *sim.Node, sIdx int, rIdx int, pruning bool) (float64, float64, bool, *sim.Node, int) {
+	sf := n.Segfile()
+	nChunks := sf.SegmentChunks(sIdx, rIdx)
+	numAllChunks := len(nChunks)
+	size := sf.SegmentSize(sIdx)
+
+	// chunks in flight are already planned for
+	needed := sf.LevelRemaining(sIdx, rIdx)
+	for _, status := range nChunks {
+		if status == segfile.PartiallyAvailable {
+			needed--
+		}
+	}
+
+	// *** BEWARE OF CALCULATING EXACT BANDWIDTH! ***
+	bandwidths := make(map[*sim.Node]float64) // 0 for peers n cannot connect to
+	bandwidth := func(p *sim.Node) float64 {
+		bw, ok := bandwidths[p]
+		if !ok {
+			if sv.CanConnect(n, p) {
+				bw = sv.Bandwidth(n, p)
+			}
+			bandwidths[p] = bw
+		}
+		return bw
+	}
+
+	// 각 row에서 가장 작은 걸 택하고, 모두 더한다.
+
+	costVec := make([]float64, numAllChunks)
+
+	var totalSeqCost float64
+	var totalPrlCost float64
+
+	var minNode *sim.Node
+	var minACIdx int
+
+	holders := n.Holders()
+	for acIdx := 0; acIdx < numAllChunks; acIdx++ {
+		costVec[acIdx] = math.Inf(1)
+		if nChunks[acIdx] != segfile.NotAvailable {
+			continue
+		}
+
+		chk, chkCost := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: acIdx}, 1.0
+		if acIdx >= size {
+			chk, chkCost = segfile.ChunkID{SIdx: sIdx, RIdx: rIdx, CIdx: acIdx - size}, 1.05
+		}
+		var best *sim.Node
+		consider := func(p *sim.Node, cost float64, bound float64) bool {
+			// holders come by decreasing bound, none of the rest can beat the best one
+			if pruning && cost/bound >= costVec[acIdx] {
+				return false
+			}
+			if bw := bandwidth(p); bw > 0 && cost/bw < costVec[acIdx] {
+				costVec[acIdx], best = cost/bw, p
+			}
+			return true
+		}
+
+		var superSeeders []*sim.Node
+		holders.EachHolder(chk, func(p *sim.Node, bound float64) bool {
+			if p.SuperSeeding() {
+				superSeeders = append(superSeeders, p)
+				return true
+			}
+			return consider(p, chkCost, bound)
+		})
+		// a super-seeder only shows n one chunk, it is checked apart from the pruned search
+		for _, p := range superSeeders {
+			if sv.VisibleStatus(n, p, chk) == segfile.Available {
+				consider(p, chkCost, math.Inf(1))
+			}
+		}
+		if acIdx >= size {
+			// a peer with the complete segment can generate any parity chunk
+			holders.EachComplete(sIdx, func(p *sim.Node, bound float64) bool {
+				if !sv.CanGenerate(n, p, sIdx) {
+					return true
+				}
+				return consider(p, 1.11, bound)
+			})
+		}
+
+		if best != nil {
+			minNode = best
+			minACIdx = acIdx
+		}
+	}
+
+	sort.Float64s(costVec)
+
+	// Update cost values
+	broken := false
+
+	for nrow := 0; nrow < needed && nrow < len(costVec); nrow++ {
+		cost := costVec[nrow]
+
+		if math.IsInf(cost, 1) {
+			broken = true
+			continue
+		}
+
+		totalSeqCost += cost
+		if totalPrlCost < cost {
+			totalPrlCost = cost
+		}
+	}
+
+	return totalSeqCost, totalPrlCost, broken, minNode, minACIdx
+}
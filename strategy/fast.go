@@ -0,0 +1,49 @@
+package strategy
+
+import (
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// getSegmentFastAction requests the first missing data chunk of segment sIdx
+// from a random holder, ignoring redundancy levels and costs
+func getSegmentFastAction(sv *sim.Supervisor, n *sim.Node, sIdx int) sim.Action {
+	sf := n.Segfile()
+	if sf.IsSegmentComplete(sIdx) {
+		return noAction()
+	}
+	nChunks := sf.SegmentChunks(sIdx, 0)
+	for chkIdx, val := range nChunks {
+		if val != segfile.NotAvailable {
+			continue
+		}
+		chk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: chkIdx}
+		act := noAction()
+		var superSeeders []*sim.Node
+		n.Holders().EachHolderFrom(chk, sv.Rand(), func(p *sim.Node) bool {
+			if !sv.CanConnect(n, p) {
+				return true
+			}
+			if p.SuperSeeding() {
+				superSeeders = append(superSeeders, p)
+				return true
+			}
+			if bw := sv.Bandwidth(n, p); bw > 0 {
+				act = sim.Action{Peer: p, Chunk: chk, Bw: bw}
+				return false
+			}
+			return true
+		})
+		if act.Peer != nil {
+			return act
+		}
+		for _, p := range superSeeders {
+			if sv.VisibleStatus(n, p, chk) == segfile.Available {
+				if bw := sv.Bandwidth(n, p); bw > 0 {
+					return sim.Action{Peer: p, Chunk: chk, Bw: bw}
+				}
+			}
+		}
+	}
+	return noAction()
+}
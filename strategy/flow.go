@@ -0,0 +1,243 @@
+package strategy
+
+import (
+	"math"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// urgentCostFactor scales the cost of urgent segments in the flow strategy so
+// they win the contended uploaders
+const urgentCostFactor = 0.1
+
+// flowAssignment is one transfer of the optimal round found by solveAssignment
+type flowAssignment struct {
+	d     *sim.Node
+	p     *sim.Node
+	chkId segfile.ChunkID
+	cost  float64
+}
+
+// chunkCost weighs a chunk by its kind the same way getCost does
+func chunkCost(rIdx int, available bool) float64 {
+	if rIdx == 0 {
+		return 1
+	}
+	if available {
+		return 1.05
+	}
+	// generated on demand by a peer holding the complete segment
+	return 1.11
+}
+
+// flowHop is an edge of the flow graph, leaving vertex from
+type flowHop struct {
+	from int
+	edge int
+}
+
+// flowCandidate is a transfer the round may use, with its path from the source to the sink
+type flowCandidate struct {
+	flowAssignment
+	path []flowHop
+}
+
+// flowRound is the flow problem of the next round of the whole swarm
+type flowRound struct {
+	g          *flowGraph
+	source     int
+	sink       int
+	roundTime  float64 // simulated seconds the fastest downloader needs to fill its in-flight slots
+	candidates []flowCandidate
+}
+
+// roundChunks returns how many chunks of chunkSize a host with free bandwidth
+// moves in roundTime, at least one as a slow host still gets a transfer
+func roundChunks(free float64, chunkSize float64, roundTime float64) int {
+	return int(math.Max(1, math.Floor(free*roundTime/chunkSize)))
+}
+
+// newFlowRound formulates the next round of the whole swarm as a min-cost
+// flow problem. Every downloader is offered its missing data chunks plus the
+// chunks of its best redundancy level per segment, limited to the number of
+// chunks the segment still needs. The capacities of the hosts are the chunks
+// their free download and upload bandwidth moves in a round, downloads are
+// also limited by MaxInFlight and transfers per pair by MaxPerPeer. A transfer
+// costs its chunk weight divided by the bandwidth the pair would get. In
+// streaming mode only segments within the lookahead are offered and urgent
+// segments are made cheaper.
+func newFlowRound(sv *sim.Supervisor) *flowRound {
+	nodes := sv.Nodes()
+	streaming := sv.Streaming().Enabled
+	r := &flowRound{g: newFlowGraph(2), source: 0, sink: 1, roundTime: math.Inf(1)}
+	g := r.g
+
+	var downloaders []*sim.Node
+	for _, d := range nodes {
+		free := d.FreeDownloadBw()
+		if d.Segfile().PlannedComplete() || d.InFlight() >= sv.MaxInFlight() || free < d.MaxDownloadBw()*sim.MinTransferShare {
+			continue
+		}
+		downloaders = append(downloaders, d)
+		r.roundTime = math.Min(r.roundTime, float64(sv.MaxInFlight())*d.Segfile().ChunkSize/free)
+	}
+
+	// nodes of one host share a vertex as they share its bandwidth
+	hostUploads := make(map[int]flowHop)
+	uploaders := make(map[*sim.Node]flowHop)
+	for _, p := range nodes {
+		free := p.FreeUploadBw()
+		if free <= 0 || p.Departed() {
+			continue
+		}
+		if _, ok := hostUploads[p.Host()]; !ok {
+			uv := g.addVertex()
+			hostUploads[p.Host()] = flowHop{uv, g.addEdge(uv, r.sink, roundChunks(free, p.Segfile().ChunkSize, r.roundTime), 0)}
+		}
+		uploaders[p] = hostUploads[p.Host()]
+	}
+
+	hostDownloads := make(map[int]flowHop)
+	for _, d := range downloaders {
+		sf := d.Segfile()
+		minBw := d.MaxDownloadBw() * sim.MinTransferShare
+		down, ok := hostDownloads[d.Host()]
+		if !ok {
+			slots := sv.MaxInFlight() - d.InFlight()
+			if chunks := roundChunks(d.FreeDownloadBw(), sf.ChunkSize, r.roundTime); chunks < slots {
+				slots = chunks
+			}
+			dv := g.addVertex()
+			down = flowHop{r.source, g.addEdge(r.source, dv, slots, 0)}
+			hostDownloads[d.Host()] = down
+		}
+		dv := g.adj[down.from][down.edge].to
+
+		// one vertex per uploader d may still connect to, limiting transfers per pair
+		pairs := make(map[*sim.Node]flowHop)
+		for _, p := range nodes {
+			if _, ok := uploaders[p]; ok && sv.CanConnect(d, p) {
+				pv := g.addVertex()
+				pairs[p] = flowHop{pv, g.addEdge(pv, uploaders[p].from, sv.MaxPerPeer()-d.Connections(p), 0)}
+			}
+		}
+
+		for sIdx := 0; sIdx < sf.NumSegments; sIdx++ {
+			if streaming && !sv.InLookahead(d, sIdx) {
+				break
+			}
+			if sf.IsSegmentComplete(sIdx) || sf.IsSegmentPlannedComplete(sIdx) {
+				continue
+			}
+			weight := 1.0
+			if streaming && sv.IsUrgent(d, sIdx) {
+				weight = urgentCostFactor
+			}
+			level := sf.BestLevel(sIdx)
+			dChunks := sf.SegmentChunks(sIdx, level)
+			needed := sf.LevelRemaining(sIdx, level)
+			for _, status := range dChunks {
+				if status == segfile.PartiallyAvailable {
+					needed--
+				}
+			}
+			if needed <= 0 {
+				continue
+			}
+			segv := g.addVertex()
+			seg := flowHop{dv, g.addEdge(dv, segv, needed, 0)}
+
+			for acIdx, status := range dChunks {
+				if status != segfile.NotAvailable {
+					continue
+				}
+				chk := segfile.ChunkID{SIdx: sIdx, RIdx: 0, CIdx: acIdx}
+				if acIdx >= sf.SegmentSize(sIdx) {
+					chk = segfile.ChunkID{SIdx: sIdx, RIdx: level, CIdx: acIdx - sf.SegmentSize(sIdx)}
+				}
+				chkv := g.addVertex()
+				chunk := flowHop{segv, g.addEdge(segv, chkv, 1, 0)}
+
+				for _, p := range nodes {
+					pair, ok := pairs[p]
+					if !ok {
+						continue
+					}
+					available := sv.VisibleStatus(d, p, chk) == segfile.Available
+					if !available && (chk.RIdx == 0 || !sv.CanGenerate(d, p, sIdx)) {
+						continue
+					}
+					bw := sv.Bandwidth(d, p)
+					if bw < minBw {
+						continue
+					}
+					cost := weight * chunkCost(chk.RIdx, available) * sf.ChunkSize / bw
+					edge := flowHop{chkv, g.addEdge(chkv, pair.from, 1, cost)}
+					r.candidates = append(r.candidates, flowCandidate{
+						flowAssignment{d, p, chk, cost},
+						[]flowHop{down, seg, chunk, edge, pair, uploaders[p]},
+					})
+				}
+			}
+		}
+	}
+	return r
+}
+
+// solve returns the cheapest assignment among those with the most transfers,
+// up to limit transfers if limit is positive, and its total cost
+func (r *flowRound) solve(limit int) ([]flowAssignment, float64) {
+	r.g.minCostFlow(r.source, r.sink, limit)
+
+	var assignments []flowAssignment
+	totalCost := 0.0
+	for _, c := range r.candidates {
+		if hop := c.path[3]; r.g.flow(hop.from, hop.edge) > 0 { // chunk to pair
+			assignments = append(assignments, c.flowAssignment)
+			totalCost += c.cost
+		}
+	}
+	return assignments, totalCost
+}
+
+// solveAssignment solves the next round of the whole swarm exactly
+func solveAssignment(sv *sim.Supervisor) ([]flowAssignment, float64) {
+	return newFlowRound(sv).solve(0)
+}
+
+// OptimalRound returns the number of transfers of the optimal next round of
+// the swarm of sv and its total cost, the bound the greedy strategies are
+// measured against. The cost of a transfer is its chunk weight times the
+// seconds the chunk takes at the bandwidth the pair would get.
+func OptimalRound(sv *sim.Supervisor) (int, float64) {
+	assignments, totalCost := solveAssignment(sv)
+	return len(assignments), totalCost
+}
+
+// getFlowActions returns the transfers of the swarm wide assignment given to
+// n, it is used as a batch strategy by the planner. The assignment is solved
+// by the first node deciding in a round and cached for the others, a node
+// left without transfers solves the round again as the swarm may have changed.
+func getFlowActions(sv *sim.Supervisor, n *sim.Node) []sim.Action {
+	round, _ := sv.RoundCache().(map[*sim.Node][]flowAssignment)
+	if len(round[n]) == 0 {
+		assignments, totalCost := solveAssignment(sv)
+		sv.Printf("%v : optimal round of %v transfers, total cost %.4f\n", n.ID(), len(assignments), totalCost)
+		round = make(map[*sim.Node][]flowAssignment)
+		for _, a := range assignments {
+			round[a.d] = append(round[a.d], a)
+		}
+		sv.SetRoundCache(round)
+	}
+
+	var acts []sim.Action
+	for _, a := range round[n] {
+		// transfers started since the round was solved may have taken the chunk or the pair
+		if n.Segfile().Status(a.chkId) == segfile.NotAvailable && sv.CanConnect(n, a.p) {
+			acts = append(acts, sim.Action{Peer: a.p, Chunk: a.chkId})
+		}
+	}
+	delete(round, n)
+	return acts
+}
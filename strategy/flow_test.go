@@ -0,0 +1,156 @@
+package strategy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+func TestMinCostMaxFlow(t *testing.T) {
+	// two downloaders, two chunks, costs {{1, 4}, {2, 1}}
+	costs := [][]float64{{1, 4}, {2, 1}}
+	g := newFlowGraph(6)
+	source, sink := 0, 5
+	edges := make([][]int, 2)
+	for i := 0; i < 2; i++ {
+		g.addEdge(source, 1+i, 1, 0)
+		g.addEdge(3+i, sink, 1, 0)
+		edges[i] = make([]int, 2)
+		for j := 0; j < 2; j++ {
+			edges[i][j] = g.addEdge(1+i, 3+j, 1, costs[i][j])
+		}
+	}
+
+	flow, cost := g.minCostMaxFlow(source, sink)
+	if flow != 2 || cost != 2 {
+		t.Errorf("Expected flow 2 with cost 2, got %v with cost %v", flow, cost)
+	}
+	if g.flow(1, edges[0][0]) != 1 || g.flow(2, edges[1][1]) != 1 {
+		t.Error("Expected the diagonal assignment")
+	}
+}
+
+func TestSolveAssignment(t *testing.T) {
+	sv := initializeTestSupervisor()
+	initializeTestNodes(sv)
+
+	r := newFlowRound(sv)
+	assignments, _ := r.solve(0)
+	if len(assignments) == 0 {
+		t.Fatal("Expected assignments, got none")
+	}
+
+	chunks := make(map[*sim.Node]map[segfile.ChunkID]struct{})
+	pairs := make(map[[2]*sim.Node]int)
+	downloads := make(map[*sim.Node]int)
+	uploads := make(map[*sim.Node]int)
+	for _, a := range assignments {
+		if chunks[a.d] == nil {
+			chunks[a.d] = make(map[segfile.ChunkID]struct{})
+		}
+		if _, ok := chunks[a.d][a.chkId]; ok {
+			t.Errorf("Chunk %v assigned twice to node %v", a.chkId, a.d.ID())
+		}
+		chunks[a.d][a.chkId] = struct{}{}
+		if a.d.Segfile().Status(a.chkId) != segfile.NotAvailable {
+			t.Errorf("Node %v already has chunk %v", a.d.ID(), a.chkId)
+		}
+		pairs[[2]*sim.Node{a.d, a.p}]++
+		downloads[a.d]++
+		uploads[a.p]++
+	}
+	for pair, count := range pairs {
+		if count > sv.MaxPerPeer() {
+			t.Errorf("Pair %v-%v has %v transfers", pair[0].ID(), pair[1].ID(), count)
+		}
+	}
+	for n, count := range downloads {
+		if count > sv.MaxInFlight() || count > roundChunks(n.FreeDownloadBw(), n.Segfile().ChunkSize, r.roundTime) {
+			t.Errorf("Node %v downloads %v chunks in a round", n.ID(), count)
+		}
+	}
+	for p, count := range uploads {
+		if count > roundChunks(p.FreeUploadBw(), p.Segfile().ChunkSize, r.roundTime) {
+			t.Errorf("Node %v uploads %v chunks, over its bandwidth in a round of %v seconds", p.ID(), count, r.roundTime)
+		}
+	}
+}
+
+// greedyRound assigns the candidates of r the way getCost does, every
+// downloader in turn taking the cheapest peer with capacity left per chunk,
+// and returns the number of transfers and their total cost
+func greedyRound(r *flowRound) (int, float64) {
+	transfers, totalCost := 0, 0.0
+	for i := 0; i < len(r.candidates); {
+		// the candidates of a chunk are consecutive
+		best := -1
+		j := i
+		for ; j < len(r.candidates) && r.candidates[j].d == r.candidates[i].d && r.candidates[j].chkId == r.candidates[i].chkId; j++ {
+			open := true
+			for _, hop := range r.candidates[j].path {
+				open = open && r.g.adj[hop.from][hop.edge].cap > 0
+			}
+			if open && (best < 0 || r.candidates[j].cost < r.candidates[best].cost) {
+				best = j
+			}
+		}
+		if best >= 0 {
+			for _, hop := range r.candidates[best].path {
+				r.g.adj[hop.from][hop.edge].cap--
+			}
+			transfers++
+			totalCost += r.candidates[best].cost
+		}
+		i = j
+	}
+	return transfers, totalCost
+}
+
+func TestOptimalRound(t *testing.T) {
+	sv := sim.NewSupervisor(sim.Scenario{Strategy: "flow", MaxInFlight: 4, MaxPerPeer: 1, Seed: 3})
+	segfileInfo, _ := segfile.NewInfo(12*sim.MB, 10, 512*sim.KB, segfile.DefaultRedundancy())
+	for i := 0; i < 10; i++ {
+		ratio := 0.4
+		if i < 2 {
+			ratio = 1
+		}
+		sv.AddNode(sv.NewNode(segfileInfo, float64(i+1)*sim.MB, 1-1/math.E, ratio))
+	}
+
+	greedy, greedyCost := greedyRound(newFlowRound(sv))
+	optimal, optimalCost := OptimalRound(sv)
+	if greedy == 0 || optimal < greedy {
+		t.Fatalf("Expected the optimal round to make at least the %v greedy transfers, got %v", greedy, optimal)
+	}
+	// the cheapest flow of the greedy size bounds the greedy cost
+	_, boundCost := newFlowRound(sv).solve(greedy)
+	if boundCost > greedyCost+1e-9 {
+		t.Errorf("Expected %v transfers to cost at most the greedy %.4f, got %.4f", greedy, greedyCost, boundCost)
+	}
+	t.Logf("greedy: %v transfers costing %.4f, optimal: %v transfers costing %.4f, %.4f for %v", greedy, greedyCost, optimal, optimalCost, boundCost, greedy)
+}
+
+func TestFlowActionsRound(t *testing.T) {
+	sv := initializeTestSupervisor()
+	initializeTestNodes(sv)
+	assignments, _ := solveAssignment(sv)
+	assigned := make(map[*sim.Node]int)
+	for _, a := range assignments {
+		assigned[a.d]++
+	}
+
+	// every node takes its share of the round solved by the first one
+	for _, n := range sv.Nodes() {
+		if assigned[n] == 0 {
+			continue
+		}
+		if acts := getFlowActions(sv, n); len(acts) != assigned[n] {
+			t.Errorf("Expected node %v to get its %v transfers of the round, got %v", n.ID(), assigned[n], len(acts))
+		}
+		if round, ok := sv.RoundCache().(map[*sim.Node][]flowAssignment); !ok || len(round[n]) != 0 {
+			t.Errorf("Expected the round to be cached without the transfers of node %v", n.ID())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package strategy
+
+import "math"
+
+type flowEdge struct {
+	to   int
+	rev  int // index of the reverse edge in adj[to]
+	cap  int
+	cost float64
+}
+
+// flowGraph is a residual graph for min-cost max-flow with integer capacities
+type flowGraph struct {
+	adj [][]flowEdge
+}
+
+func newFlowGraph(numVertices int) *flowGraph {
+	return &flowGraph{make([][]flowEdge, numVertices)}
+}
+
+func (g *flowGraph) addVertex() int {
+	g.adj = append(g.adj, nil)
+	return len(g.adj) - 1
+}
+
+// addEdge adds an edge and returns its index in adj[from]
+func (g *flowGraph) addEdge(from int, to int, capacity int, cost float64) int {
+	g.adj[from] = append(g.adj[from], flowEdge{to, len(g.adj[to]), capacity, cost})
+	g.adj[to] = append(g.adj[to], flowEdge{from, len(g.adj[from]) - 1, 0, -cost})
+	return len(g.adj[from]) - 1
+}
+
+// flow returns the flow pushed through edge idx of vertex from
+func (g *flowGraph) flow(from int, idx int) int {
+	e := g.adj[from][idx]
+	return g.adj[e.to][e.rev].cap
+}
+
+// minCostMaxFlow pushes as much flow as possible from s to t at the lowest
+// total cost using successive shortest paths found with Bellman-Ford
+func (g *flowGraph) minCostMaxFlow(s int, t int) (int, float64) {
+	return g.minCostFlow(s, t, 0)
+}
+
+// minCostFlow is minCostMaxFlow stopping at limit units of flow if limit is
+// positive. Every augmentation takes the cheapest path left, so the flow found
+// is the cheapest of its value.
+func (g *flowGraph) minCostFlow(s int, t int, limit int) (int, float64) {
+	const eps = 1e-12
+	numVertices := len(g.adj)
+	dist := make([]float64, numVertices)
+	inQueue := make([]bool, numVertices)
+	prevVertex := make([]int, numVertices)
+	prevEdge := make([]int, numVertices)
+
+	totalFlow := 0
+	totalCost := 0.0
+	for limit <= 0 || totalFlow < limit {
+		for v := range dist {
+			dist[v] = math.Inf(1)
+			prevVertex[v] = -1
+		}
+		dist[s] = 0
+		queue := []int{s}
+		inQueue[s] = true
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			inQueue[v] = false
+			for i, e := range g.adj[v] {
+				if e.cap > 0 && dist[v]+e.cost < dist[e.to]-eps {
+					dist[e.to] = dist[v] + e.cost
+					prevVertex[e.to] = v
+					prevEdge[e.to] = i
+					if !inQueue[e.to] {
+						queue = append(queue, e.to)
+						inQueue[e.to] = true
+					}
+				}
+			}
+		}
+		if math.IsInf(dist[t], 1) {
+			return totalFlow, totalCost
+		}
+
+		// bottleneck capacity along the path
+		push := math.MaxInt32
+		for v := t; v != s; v = prevVertex[v] {
+			if c := g.adj[prevVertex[v]][prevEdge[v]].cap; c < push {
+				push = c
+			}
+		}
+		if limit > 0 && push > limit-totalFlow {
+			push = limit - totalFlow
+		}
+		for v := t; v != s; v = prevVertex[v] {
+			e := &g.adj[prevVertex[v]][prevEdge[v]]
+			e.cap -= push
+			g.adj[v][e.rev].cap += push
+		}
+		totalFlow += push
+		totalCost += float64(push) * dist[t]
+	}
+	return totalFlow, totalCost
+}
@@ -0,0 +1,25 @@
+// Package strategy implements the transfer strategies of the simulator and
+// registers them with package sim, import it for its side effects:
+//
+//	import _ "github.com/minwhoo/dyrest-sim/strategy"
+//
+// The strategies are "dyrest", the original cost based choice over every
+// redundancy level, "fast", which takes the first data chunk it can get,
+// "adaptive", which targets one redundancy level per segment chosen from the
+// observed failure rate, and "flow", which solves the next round of the whole
+// swarm as a min-cost max-flow problem.
+package strategy
+
+import "github.com/minwhoo/dyrest-sim/sim"
+
+func init() {
+	sim.RegisterStrategy("dyrest", getSegmentOptimalAction)
+	sim.RegisterStrategy("fast", getSegmentFastAction)
+	sim.RegisterStrategy("adaptive", getSegmentAdaptiveAction)
+	sim.RegisterBatchStrategy("flow", getFlowActions)
+}
+
+// noAction is returned when a segment cannot be served right now
+func noAction() sim.Action {
+	return sim.Action{}
+}
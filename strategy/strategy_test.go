@@ -0,0 +1,144 @@
+package strategy
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/minwhoo/dyrest-sim/segfile"
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+func initializeTestSupervisor() *sim.Supervisor {
+	return sim.NewSupervisor(sim.Scenario{Strategy: "dyrest", MaxInFlight: 10, MaxPerPeer: 1})
+}
+
+func initializeTestNodes(sv *sim.Supervisor) {
+	segfileInfo, _ := segfile.NewInfo(12*sim.MB, 10, 512*sim.KB, segfile.DefaultRedundancy())
+	for i := 0; i < 10; i++ {
+		var ratio float64
+		if ratio = 0.4; i == 7 {
+			ratio = 1.0
+		}
+		sv.AddNode(sv.NewNode(segfileInfo, 10*sim.MB, 1-1/math.E, ratio))
+	}
+}
+
+func getUncompletedNode(sv *sim.Supervisor) *sim.Node {
+	for _, p := range sv.Nodes() {
+		if !p.Complete() {
+			return p
+		}
+	}
+	return nil
+}
+
+// initializeBenchSupervisor builds a swarm of numNodes leechers holding 40% of
+// a 100 MB file each, served by 10 seeders
+func initializeBenchSupervisor(numNodes int) (*sim.Supervisor, *sim.Node) {
+	sv := sim.NewSupervisor(sim.Scenario{Strategy: "dyrest", MaxInFlight: 10, MaxPerPeer: 1, Seed: 1})
+	segfileInfo, _ := segfile.NewInfo(100*sim.MB, 10, 512*sim.KB, segfile.DefaultRedundancy())
+	var n *sim.Node
+	for i := 0; i < numNodes; i++ {
+		ratio := 0.4
+		if i < 10 {
+			ratio = 1
+		}
+		n = sv.NewNode(segfileInfo, 10*sim.MB, 0.632, ratio)
+		sv.AddNode(n)
+	}
+	return sv, n
+}
+
+func TestGetCost(t *testing.T) {
+	sv := initializeTestSupervisor()
+	initializeTestNodes(sv)
+	n := getUncompletedNode(sv)
+
+	seqCost, prlCost, broken, p, acIdx := getCost(sv, n, 0, 1)
+	if p == nil || broken {
+		t.Fatal("Expected a peer to complete the segment from")
+	}
+	if seqCost <= 0 || math.IsInf(seqCost, 1) || prlCost <= 0 || prlCost > seqCost {
+		t.Errorf("Expected 0 < parallel cost %v <= sequential cost %v", prlCost, seqCost)
+	}
+	chk := segfile.ChunkID{SIdx: 0, RIdx: 0, CIdx: acIdx}
+	if size := n.Segfile().SegmentSize(0); acIdx >= size {
+		chk = segfile.ChunkID{SIdx: 0, RIdx: 1, CIdx: acIdx - size}
+	}
+	if n.Segfile().Status(chk) != segfile.NotAvailable {
+		t.Errorf("Expected the cheapest chunk %v to be missing at node %v", chk, n.ID())
+	}
+	if p.Segfile().Status(chk) != segfile.Available && !p.Segfile().IsSegmentComplete(0) {
+		t.Errorf("Expected node %v to hold or generate chunk %v", p.ID(), chk)
+	}
+}
+
+func TestOptimalAction(t *testing.T) {
+	sv := initializeTestSupervisor()
+	initializeTestNodes(sv)
+	n := getUncompletedNode(sv)
+
+	act := getOptimalAction(sv, n)
+	if act.Peer == nil {
+		t.Fatal("Expected action, got none")
+	}
+	if act.Peer == n || !n.SameFile(act.Peer) {
+		t.Errorf("Expected a peer of the swarm, got node %v", act.Peer.ID())
+	}
+	if n.Segfile().Status(act.Chunk) != segfile.NotAvailable {
+		t.Errorf("Expected chunk %v to be missing at node %v", act.Chunk, n.ID())
+	}
+	if act.Peer.Segfile().Status(act.Chunk) != segfile.Available && !act.Peer.Segfile().IsSegmentComplete(act.Chunk.SIdx) {
+		t.Errorf("Expected node %v to hold or generate chunk %v", act.Peer.ID(), act.Chunk)
+	}
+	if act.Bw <= 0 || act.Bw > n.MaxDownloadBw() || act.Bw > act.Peer.MaxUploadBw() {
+		t.Errorf("Expected a bandwidth within both capacities, got %v", act.Bw)
+	}
+}
+
+// TestGetCostPruning checks that stopping at the rate bounds finds the same
+// costs as searching every holder
+func TestGetCostPruning(t *testing.T) {
+	sv, n := initializeBenchSupervisor(200)
+	// busy uploaders fall below their bound
+	busy := sv.NewNode(n.Segfile().Info, 10*sim.MB, 0.632, 0)
+	for i, p := range sv.Nodes() {
+		if p != n {
+			busy.PrepareTransfer(sim.Action{Peer: p, Chunk: n.Segfile().DataChunk(i % n.Segfile().NumDataChunks), Bw: p.MaxUploadBw() * sv.Rand().Float64()})
+		}
+	}
+	for sIdx := 0; sIdx < n.Segfile().NumSegments; sIdx++ {
+		for rIdx := 1; rIdx <= n.Segfile().NumLevels(); rIdx++ {
+			seq, prl, broken, _, _ := segmentCost(sv, n, sIdx, rIdx, true)
+			fullSeq, fullPrl, fullBroken, _, _ := segmentCost(sv, n, sIdx, rIdx, false)
+			if math.Abs(seq-fullSeq) > 1e-12 || math.Abs(prl-fullPrl) > 1e-12 || broken != fullBroken {
+				t.Fatalf("Expected the costs of segment %v level %v to match, got %v %v, %v %v", sIdx, rIdx, seq, prl, fullSeq, fullPrl)
+			}
+		}
+	}
+}
+
+func benchmarkDecision(b *testing.B, f sim.SegmentStrategy) {
+	for _, numNodes := range []int{100, 1000, 10000} {
+		sv, n := initializeBenchSupervisor(numNodes)
+		b.Run(fmt.Sprintf("nodes=%d", numNodes), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f(sv, n, i%n.Segfile().NumSegments)
+			}
+		})
+	}
+}
+
+func BenchmarkSegmentOptimalAction(b *testing.B) {
+	benchmarkDecision(b, getSegmentOptimalAction)
+}
+
+func BenchmarkSegmentFastAction(b *testing.B) {
+	benchmarkDecision(b, getSegmentFastAction)
+}
+
+func BenchmarkSegmentAdaptiveAction(b *testing.B) {
+	benchmarkDecision(b, getSegmentAdaptiveAction)
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+// maximum number of messages queued for a single viewer before it is dropped
+const clientSendBuffer = 256
+
+type client struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+type command struct {
+	c   *client
+	req CommandRequest
+}
+
+// hub fans out simulation events to every connected viewer and runs viewer
+// commands one at a time without blocking the connections
+type hub struct {
+	lock     sync.RWMutex
+	clients  map[*client]struct{}
+	commands chan command
+}
+
+func newHub() *hub {
+	return &hub{
+		clients:  make(map[*client]struct{}),
+		commands: make(chan command, 16),
+	}
+}
+
+func (h *hub) register(c *client) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.clients[c] = struct{}{}
+}
+
+func (h *hub) unregister(c *client) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.drop(c)
+}
+
+// drop must be called with the write lock held
+func (h *hub) drop(c *client) {
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *hub) broadcast(msg []byte) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- msg:
+		default:
+			log.Println("WEB: ERROR Viewer too slow, dropping connection")
+			h.drop(c)
+		}
+	}
+}
+
+func (h *hub) sendTo(c *client, msg []byte) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- msg:
+	default:
+		log.Println("WEB: ERROR Viewer too slow, dropping connection")
+		h.drop(c)
+	}
+}
+
+// run broadcasts every event until the channel is closed
+func (h *hub) run(events <-chan []byte) {
+	for msg := range events {
+		h.broadcast(msg)
+	}
+}
+
+// runCommands executes queued commands in order and replies to the sender
+func (h *hub) runCommands(sm *sim.Manager) {
+	for cmd := range h.commands {
+		err := executeCommand(sm, cmd.req)
+		if err != nil {
+			log.Println("SIM: ERROR", cmd.req.Command, err)
+		}
+		msg, jsonErr := newCommandResult(cmd.req.Command, err)
+		if jsonErr == nil {
+			h.sendTo(cmd.c, msg)
+		}
+	}
+}
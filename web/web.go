@@ -0,0 +1,173 @@
+// Package web serves the simulator to browsers: a viewer page, a websocket
+// streaming simulation events and accepting commands, and Prometheus metrics.
+package web
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+)
+
+//go:embed index.html
+var indexPage []byte
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// Server is the web interface of one simulation manager
+type Server struct {
+	sm  *sim.Manager
+	hub *hub
+}
+
+// NewServer returns a server controlling sm. Events must be the channel sm
+// was created with, the server always drains it, even with no viewers connected.
+func NewServer(sm *sim.Manager, events <-chan []byte) *Server {
+	s := &Server{sm, newHub()}
+	go s.hub.run(events)
+	go s.hub.runCommands(sm)
+	return s
+}
+
+// Handler returns the handler serving the viewer on /, the websocket on /ws and the metrics on /metrics
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveWeb)
+	mux.HandleFunc("/ws", s.serveWebsocket)
+	mux.HandleFunc("/metrics", s.serveMetrics)
+	return mux
+}
+
+// ListenAndServe serves the web interface on addr
+func (s *Server) ListenAndServe(addr string) error {
+	log.Println("WEB: Starting web server...")
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// CommandRequest is a command sent by a viewer as JSON, e.g.
+// {"Command": "initialize", "Scenario": {"NumNodes": 10}} or {"Command": "step", "Steps": 5}
+type CommandRequest struct {
+	Command  string
+	Steps    int
+	Scenario *sim.Scenario // fields left out keep their default value
+}
+
+func parseCommandRequest(message []byte) (CommandRequest, error) {
+	sc := sim.DefaultScenario()
+	req := CommandRequest{Steps: 1, Scenario: &sc}
+	if err := json.Unmarshal(message, &req); err != nil {
+		return req, fmt.Errorf("malformed command: %v", err)
+	}
+	if req.Scenario == nil {
+		req.Scenario = &sc
+	}
+	return req, nil
+}
+
+func executeCommand(sm *sim.Manager, req CommandRequest) error {
+	switch req.Command {
+	case "initialize":
+		return sm.Initialize(*req.Scenario)
+	case "start":
+		return sm.Start()
+	case "stop":
+		return sm.Stop()
+	case "pause":
+		return sm.Pause()
+	case "resume":
+		return sm.Resume()
+	case "step":
+		return sm.Step(req.Steps)
+	case "reset":
+		return sm.Reset()
+	}
+	return fmt.Errorf("unknown command %q", req.Command)
+}
+
+func newCommandResult(command string, cmdErr error) ([]byte, error) {
+	data := sim.CommandResultData{Command: command, Ok: cmdErr == nil}
+	if cmdErr != nil {
+		data.Error = cmdErr.Error()
+	}
+	return json.Marshal(sim.Message{Code: sim.MessageCommandResult, Data: data})
+}
+
+func (s *Server) readWebsocketConnection(c *client) {
+	defer func() {
+		s.hub.unregister(c)
+		c.conn.Close()
+		log.Println("WEB: Connection closed!")
+	}()
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		fmt.Println("message receieved: ", string(message))
+		req, err := parseCommandRequest(message)
+		if err != nil {
+			if msg, jsonErr := newCommandResult(req.Command, err); jsonErr == nil {
+				s.hub.sendTo(c, msg)
+			}
+			continue
+		}
+		s.hub.commands <- command{c, req}
+	}
+}
+
+func writeWebsocketConnection(c *client) {
+	defer c.conn.Close()
+
+	for data := range c.send {
+		err := c.conn.WriteMessage(websocket.TextMessage, data)
+		if err != nil {
+			break
+		}
+	}
+}
+
+// serveWebsocket handles websocket requests from the peer.
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("WEB: Connection created!")
+	c := &client{conn, make(chan []byte, clientSendBuffer)}
+	s.hub.register(c)
+	go s.readWebsocketConnection(c)
+	go writeWebsocketConnection(c)
+}
+
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.sm.WriteMetrics(w)
+}
+
+func serveWeb(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+	if r.URL.Path != "/" {
+		http.Error(w, "Not found", 404)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexPage)
+}
@@ -0,0 +1,143 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/minwhoo/dyrest-sim/sim"
+	_ "github.com/minwhoo/dyrest-sim/strategy"
+)
+
+type received struct {
+	Code int
+	Data json.RawMessage
+}
+
+func TestParseCommandRequest(t *testing.T) {
+	req, err := parseCommandRequest([]byte(`{"Command": "initialize", "Scenario": {"NumNodes": 10}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := sim.DefaultScenario()
+	if req.Command != "initialize" || req.Steps != 1 || req.Scenario.NumNodes != 10 || req.Scenario.FileSize != def.FileSize {
+		t.Errorf("Expected a scenario of 10 nodes keeping the other defaults, got %+v", req)
+	}
+
+	req, err = parseCommandRequest([]byte(`{"Command": "step", "Steps": 5, "Scenario": null}`))
+	if err != nil || req.Steps != 5 || req.Scenario == nil {
+		t.Errorf("Expected 5 steps with the default scenario, got %+v, %v", req, err)
+	}
+
+	if _, err := parseCommandRequest([]byte(`{"Command": `)); err == nil {
+		t.Error("Expected malformed JSON to be rejected")
+	}
+	if err := executeCommand(sim.NewManager(nil), CommandRequest{Command: "explode"}); err == nil {
+		t.Error("Expected an unknown command to be rejected")
+	}
+}
+
+// dial connects a viewer to s
+func dial(t *testing.T, s *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// sendCommand sends req on conn and returns its result, the events received
+// meanwhile are returned too
+func sendCommand(t *testing.T, conn *websocket.Conn, req string) (sim.CommandResultData, []received) {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	var events []received
+	for {
+		msg := next(t, conn)
+		if msg.Code != sim.MessageCommandResult {
+			events = append(events, msg)
+			continue
+		}
+		var res sim.CommandResultData
+		if err := json.Unmarshal(msg.Data, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res, events
+	}
+}
+
+func next(t *testing.T, conn *websocket.Conn) received {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg received
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestViewers(t *testing.T) {
+	events := make(chan []byte)
+	sm := sim.NewManager(events)
+	s := httptest.NewServer(NewServer(sm, events).Handler())
+	defer s.Close()
+
+	a, b := dial(t, s), dial(t, s)
+	defer a.Close()
+	defer b.Close()
+	// a viewer answered once is registered with the hub
+	for _, conn := range []*websocket.Conn{a, b} {
+		if res, _ := sendCommand(t, conn, `{"Command": "resume"}`); !res.Ok {
+			t.Fatalf("Expected resume to succeed, got %+v", res)
+		}
+	}
+
+	res, seen := sendCommand(t, a, `{"Command": "initialize", "Scenario": {"NumNodes": 5, "Seed": 1}}`)
+	if !res.Ok || res.Command != "initialize" {
+		t.Fatalf("Expected the scenario to be initialized, got %+v", res)
+	}
+	// both viewers see every node of the swarm, the sender before the result
+	for i, conn := range []*websocket.Conn{a, b} {
+		added := 0
+		if i == 0 {
+			for _, msg := range seen {
+				if msg.Code == sim.MessageNodeAdded {
+					added++
+				}
+			}
+		}
+		for added < 5 {
+			if msg := next(t, conn); msg.Code == sim.MessageNodeAdded {
+				added++
+			}
+		}
+	}
+
+	res, _ = sendCommand(t, b, `{"Command": "explode"}`)
+	if res.Ok || res.Command != "explode" || !strings.Contains(res.Error, "unknown command") {
+		t.Errorf("Expected the unknown command to be rejected, got %+v", res)
+	}
+	res, _ = sendCommand(t, b, `{"Command": `)
+	if res.Ok || !strings.Contains(res.Error, "malformed") {
+		t.Errorf("Expected the malformed command to be rejected, got %+v", res)
+	}
+
+	resp, err := http.Get(s.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "\ndyrest_nodes 5\n") {
+		t.Errorf("Expected the metrics to count 5 nodes, got\n%s", body)
+	}
+}